@@ -0,0 +1,240 @@
+package fasthttp
+
+import (
+	"errors"
+	"github.com/vela-ssoc/vela-kit/kind"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	connRejected = errors.New("connection rejected by acl")
+)
+
+// ipTrie 按bit存储的前缀树 查询最长匹配的前缀长度
+type ipTrie struct {
+	root *trieNode
+	size int
+}
+
+type trieNode struct {
+	child [2]*trieNode
+	leaf  bool
+}
+
+func trieKey(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+// trieNet 网段的key和掩码长度 ipv4映射的网段(::ffff:0:0/96)掩码长度减去96 超出地址长度时返回false
+func trieNet(cidr *net.IPNet) (net.IP, int, bool) {
+	ones, bits := cidr.Mask.Size()
+	ip := trieKey(cidr.IP)
+	if len(ip) == net.IPv4len && bits == 8*net.IPv6len {
+		ones -= 96
+	}
+
+	if ip == nil || ones < 0 || ones > len(ip)*8 {
+		return nil, 0, false
+	}
+	return ip, ones, true
+}
+
+func (t *ipTrie) insert(cidr *net.IPNet) {
+	ip, ones, ok := trieNet(cidr)
+	if !ok {
+		xEnv.Errorf("acl invalid cidr %s", cidr.String())
+		return
+	}
+
+	if t.root == nil {
+		t.root = &trieNode{}
+	}
+
+	node := t.root
+	for i := 0; i < ones; i++ {
+		bit := ip[i/8] >> (7 - uint(i%8)) & 1
+		if node.child[bit] == nil {
+			node.child[bit] = &trieNode{}
+		}
+		node = node.child[bit]
+	}
+
+	if !node.leaf {
+		node.leaf = true
+		t.size++
+	}
+}
+
+// match 返回最长匹配的前缀长度 没有匹配返回-1
+func (t *ipTrie) match(ip net.IP) int {
+	if t.root == nil {
+		return -1
+	}
+
+	ip = trieKey(ip)
+	best := -1
+	node := t.root
+	for i := 0; node != nil; i++ {
+		if node.leaf {
+			best = i
+		}
+
+		if i == len(ip)*8 {
+			break
+		}
+
+		node = node.child[ip[i/8]>>(7-uint(i%8))&1]
+	}
+	return best
+}
+
+// acl 连接级别的黑白名单 ipv4和ipv6分开存储
+type acl struct {
+	mu    sync.RWMutex
+	allow [2]ipTrie
+	deny  [2]ipTrie
+
+	//配置的原始规则 配置导出使用
+	allowRules []string
+	denyRules  []string
+
+	rejected uint64
+}
+
+func newACL() *acl {
+	return &acl{}
+}
+
+func family(ip net.IP) int {
+	if ip.To4() != nil {
+		return 0
+	}
+	return 1
+}
+
+func (a *acl) Allow(cidr ...*net.IPNet) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, item := range cidr {
+		a.allow[family(item.IP)].insert(item)
+		a.allowRules = append(a.allowRules, item.String())
+	}
+}
+
+func (a *acl) Deny(cidr ...*net.IPNet) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, item := range cidr {
+		a.deny[family(item.IP)].insert(item)
+		a.denyRules = append(a.denyRules, item.String())
+	}
+}
+
+func (a *acl) Rules() (allow []string, deny []string) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]string{}, a.allowRules...), append([]string{}, a.denyRules...)
+}
+
+func (a *acl) empty() bool {
+	return a.allow[0].size+a.allow[1].size+a.deny[0].size+a.deny[1].size == 0
+}
+
+// permit 最长前缀优先 长度相同deny优先 配置了allow时未命中的拒绝
+func (a *acl) permit(ip net.IP) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.empty() {
+		return true
+	}
+
+	f := family(ip)
+	al := a.allow[f].match(ip)
+	dl := a.deny[f].match(ip)
+
+	switch {
+	case al > dl:
+		return true
+	case dl >= 0:
+		return false
+	default:
+		return a.allow[0].size+a.allow[1].size == 0
+	}
+}
+
+func (a *acl) Rejected() uint64 {
+	return atomic.LoadUint64(&a.rejected)
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch x := addr.(type) {
+	case *net.TCPAddr:
+		return x.IP
+	case *net.UDPAddr:
+		return x.IP
+	default:
+		return nil
+	}
+}
+
+// permit 检查连接地址 拒绝的计数并且按照配置输出日志
+func (fss *server) permit(remote, local net.Addr) bool {
+	ip := addrIP(remote)
+	if ip == nil {
+		return true
+	}
+
+	a := fss.cfg.acl
+	if a.permit(ip) {
+		return true
+	}
+
+	atomic.AddUint64(&a.rejected, 1)
+	if fss.cfg.aclLog != "on" || fss.cfg.output == nil {
+		return false
+	}
+
+	enc := kind.NewJsonEncoder()
+	enc.Tab("")
+	enc.KV("time", time.Now().Format(time.RFC3339))
+	enc.KV("server", fss.Name())
+	enc.KV("action", "reject")
+	enc.KV("remote_addr", ip.String())
+	enc.KV("remote_port", xPort(remote))
+	enc.KV("server_addr", local.String())
+	enc.End("}")
+	fss.cfg.output.Write(enc.Bytes())
+	return false
+}
+
+// aclListener accept阶段直接关闭被拒绝的连接
+type aclListener struct {
+	net.Listener
+	fss *server
+}
+
+func newACLListener(ln net.Listener, fss *server) *aclListener {
+	return &aclListener{Listener: ln, fss: fss}
+}
+
+func (al *aclListener) Accept() (net.Conn, error) {
+	for {
+		c, err := al.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if al.fss.permit(c.RemoteAddr(), c.LocalAddr()) {
+			return c, nil
+		}
+
+		_ = c.Close()
+	}
+}
@@ -0,0 +1,73 @@
+package fasthttp
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseCIDR(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "1.2.3.4", want: "1.2.3.4/32"},
+		{in: "10.0.0.0/8", want: "10.0.0.0/8"},
+		{in: "2001:db8::1", want: "2001:db8::1/128"},
+		{in: "::ffff:1.2.3.4", want: "1.2.3.4/32"},
+		{in: "::ffff:0:0/96", want: "0.0.0.0/0"},
+		{in: "::ffff:10.0.0.0/104", want: "10.0.0.0/8"},
+		{in: "::ffff:0:0/80", want: "::/80"},
+		{in: "1.2.3", err: true},
+	}
+
+	for _, c := range cases {
+		cidr, err := parseCIDR(c.in)
+		if c.err {
+			if err == nil {
+				t.Errorf("%s want error got %s", c.in, cidr)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s error %v", c.in, err)
+			continue
+		}
+
+		if got := cidr.String(); got != c.want {
+			t.Errorf("%s got %s want %s", c.in, got, c.want)
+		}
+	}
+}
+
+func TestACLMappedCIDR(t *testing.T) {
+	useTestEnv(t)
+
+	cases := []struct {
+		cidr  string
+		ip    string
+		allow bool
+	}{
+		{cidr: "::ffff:0:0/96", ip: "1.2.3.4", allow: false},
+		{cidr: "::ffff:0:0/96", ip: "2001:db8::1", allow: true},
+		{cidr: "::ffff:10.0.0.0/104", ip: "10.1.2.3", allow: false},
+		{cidr: "::ffff:10.0.0.0/104", ip: "11.1.2.3", allow: true},
+		{cidr: "::ffff:10.0.0.0/104", ip: "::ffff:10.1.2.3", allow: false},
+		{cidr: "::ffff:0:0/80", ip: "1.2.3.4", allow: true},
+	}
+
+	for _, c := range cases {
+		//不经过parseCIDR 直接使用标准库解析的网段 不能越界
+		_, cidr, err := net.ParseCIDR(c.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a := newACL()
+		a.Deny(cidr)
+		if got := a.permit(net.ParseIP(c.ip)); got != c.allow {
+			t.Errorf("deny %s ip %s got %v want %v", c.cidr, c.ip, got, c.allow)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package fasthttp
+
+import (
+	"github.com/valyala/fasthttp"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// adaptorLogger 把fasthttp内部日志转到xEnv
+type adaptorLogger struct{}
+
+func (adaptorLogger) Printf(format string, args ...interface{}) {
+	xEnv.Errorf(format, args...)
+}
+
+// adaptor 把net/http的请求(h2,h3)转换成RequestCtx 复用同一套Handler
+func (fss *server) adaptor(conn net.Conn, handler fasthttp.RequestHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := &fasthttp.RequestCtx{}
+		ctx.Init2(conn, adaptorLogger{}, false)
+
+		if err := fss.convert(ctx, r); err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		handler(ctx)
+		fss.reply(ctx, w)
+		ctx.ResetUserValues()
+	}
+}
+
+func (fss *server) convert(ctx *RequestCtx, r *http.Request) error {
+	req := &ctx.Request
+	req.Header.SetMethod(r.Method)
+	req.Header.SetProtocol(r.Proto)
+	req.SetRequestURI(r.URL.RequestURI())
+	req.Header.SetHost(r.Host)
+
+	for key, val := range r.Header {
+		for _, iv := range val {
+			req.Header.Add(key, iv)
+		}
+	}
+
+	if r.TLS != nil {
+		req.URI().SetScheme("https")
+	}
+
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+
+	limit := int64(fss.cfg.maxRequestBodySize())
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		return err
+	}
+
+	if int64(len(body)) > limit {
+		return fasthttp.ErrBodyTooLarge
+	}
+
+	req.SetBodyRaw(body)
+	return nil
+}
+
+func (fss *server) reply(ctx *RequestCtx, w http.ResponseWriter) {
+	h := w.Header()
+	ctx.Response.Header.VisitAll(func(key, val []byte) {
+		switch k := string(key); k {
+		//逐跳头和长度单独处理
+		case fasthttp.HeaderConnection, fasthttp.HeaderTransferEncoding, fasthttp.HeaderKeepAlive, fasthttp.HeaderContentLength:
+		default:
+			h.Add(k, string(val))
+		}
+	})
+
+	if !ctx.Response.IsBodyStream() {
+		h.Set(fasthttp.HeaderContentLength, strconv.Itoa(len(ctx.Response.Body())))
+	} else if size := ctx.Response.Header.ContentLength(); size >= 0 {
+		h.Set(fasthttp.HeaderContentLength, strconv.Itoa(size))
+	}
+
+	w.WriteHeader(ctx.Response.StatusCode())
+
+	if ctx.IsHead() {
+		ctx.Response.ResetBody()
+		return
+	}
+
+	if err := ctx.Response.BodyWriteTo(w); err != nil {
+		xEnv.Errorf("%s web %s write body error %v", fss.Name(), ctx.Request.Header.Protocol(), err)
+	}
+}
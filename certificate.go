@@ -0,0 +1,112 @@
+package fasthttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+)
+
+var (
+	invalidCertKey = errors.New("invalid certificate key file")
+)
+
+type certificate struct {
+	//证书路径
+	name string
+	key  string
+
+	//上次修改时间
+	mtime int64
+
+	cert *tls.Certificate
+}
+
+func (c *certificate) Close() error {
+	return nil
+}
+
+func (c *certificate) MTime() int64 {
+	return c.mtime
+}
+
+func (c *certificate) Option() interface{} {
+	return c.key
+}
+
+func (c *certificate) Match(v string) bool {
+	return c.name == v
+}
+
+// Watch 只轮换私钥时也需要重新加载
+func (c *certificate) Watch() []string {
+	return []string{c.key}
+}
+
+func compileCertificate(filename string, args ...interface{}) (PoolItemIFace, error) {
+	if len(args) == 0 {
+		return nil, invalidCertKey
+	}
+
+	key, ok := args[0].(string)
+	if !ok || key == "" {
+		return nil, invalidCertKey
+	}
+
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(filename, key)
+	if err != nil {
+		return nil, err
+	}
+
+	xEnv.Errorf("certificate %s compile succeed", filename)
+	return &certificate{
+		name:  filename,
+		key:   key,
+		mtime: latestMTime(stat.ModTime().Unix(), key),
+		cert:  &cert,
+	}, nil
+}
+
+func requireCertificate(filename, key string) (*certificate, error) {
+	//查看缓存
+	item := certPool.Get(filename)
+	if item != nil {
+		return item.val.(*certificate), nil
+	}
+
+	c, err := compileCertificate(filename, key)
+	recordCompile("cert", filename, err)
+	if err != nil {
+		return nil, err
+	}
+
+	certPool.insert(filename, c)
+	return c.(*certificate), nil
+}
+
+// certInUse 运行中的server vhost和路由文件是否还在使用这个证书 共用的证书不能随着一个vhost关闭
+func certInUse(file string) bool {
+	used := false
+	match := func(key string, val PoolItemIFace) {
+		if r, ok := val.(*vRouter); ok && r.cert == file {
+			used = true
+		}
+	}
+
+	for _, fss := range metricsServers.list() {
+		if fss.cfg.cert == file {
+			return true
+		}
+
+		if fss.vhost.Range(match); used {
+			return true
+		}
+	}
+
+	routerPool.Range(match)
+	return used
+}
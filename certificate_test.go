@@ -0,0 +1,27 @@
+package fasthttp
+
+import "testing"
+
+func TestCertInUse(t *testing.T) {
+	useTestEnv(t)
+
+	fss := &server{cfg: &config{name: "cert-in-use", cert: "/srv/a.pem"}, vhost: newPool()}
+	if err := fss.addVhost("b.com", &vRouter{cert: "/srv/b.pem"}); err != nil {
+		t.Fatal(err)
+	}
+
+	metricsServers.register(fss)
+	defer metricsServers.unregister(fss)
+
+	for file, want := range map[string]bool{"/srv/a.pem": true, "/srv/b.pem": true, "/srv/c.pem": false} {
+		if got := certInUse(file); got != want {
+			t.Errorf("%s got %v want %v", file, got, want)
+		}
+	}
+
+	//vhost移除之后证书不再被引用
+	fss.vhost.remove("b.com")
+	if certInUse("/srv/b.pem") {
+		t.Errorf("/srv/b.pem still in use after vhost removed")
+	}
+}
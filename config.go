@@ -2,11 +2,18 @@ package fasthttp
 
 import (
 	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
 	"github.com/vela-ssoc/vela-kit/auxlib"
 	"github.com/vela-ssoc/vela-kit/lua"
+	"net"
 	"os"
+	"strings"
+	"sync/atomic"
 )
 
+const minBufferSize = 1024
+
 var (
 	defaultAccessJsonFormat = "[${time}] - [${remote_port}] - ${server_addr}:${server_port} ${remote_addr} " +
 		"${method} [${scheme}] [${host}] ${uri} ${query} ${ua} ${referer} ${status} ${size} ${region_city}"
@@ -15,16 +22,50 @@ var (
 type config struct {
 	//基础配置
 	name      string
-	bind      auxlib.URL // tcp://0.0.0.0:9090?read_timeout=100&idle_timeout=100
+	bind      []auxlib.URL // tcp://0.0.0.0:9090?read_timeout=100&idle_timeout=100
+	cert      string       // tls://0.0.0.0:443 证书路径
+	key       string
 	router    string
 	handler   string
 	keepalive string
 	reuseport string
+	http2     string
+	h2c       string
 	daemon    string
 	region    string
+	drain     int // drain_timeout 秒
+	proxy     string
+	trusted   []*net.IPNet // PROXY协议可信来源
+	acl       *acl
+	aclLog    string
+	onConnect atomic.Pointer[lua.LFunction] // 运行时通过http.on_connect设置 accept中读取
+	onClose   atomic.Pointer[lua.LFunction]
+	status    string // 状态页路径
+	statusACL *acl
+
+	requestIDName    string       // 请求id头 off 不复用也不返回
+	requestIDTrusted []*net.IPNet // 复用请求id头的可信来源
+
+	trace lua.Writer // span 输出
+	phase phases     // 请求阶段
+
 	notFound  *HandleChains
 	variables map[string]string
 
+	//fasthttp.Server 参数 bind上的参数优先
+	readTimeout   int // 秒
+	writeTimeout  int
+	idleTimeout   int
+	maxBodySize   int
+	concurrency   int
+	maxConnsPerIP int
+	maxReqPerConn int
+	readBuffer    int
+	writeBuffer   int
+	noNormalizing string
+	reduceMemory  string
+	serverName    string // off 不返回server头
+
 	//下面对象配置
 	fd     *os.File
 	output lua.Writer
@@ -41,12 +82,15 @@ func newConfig(L *lua.LState) *config {
 	cnn.pretreatment(defaultAccessJsonFormat)
 
 	cfg := &config{
-		router:    xEnv.Prefix() + "/www/vhost",
-		handler:   xEnv.Prefix() + "/www/handle",
-		access:    cnn.Line,
-		r:         newRouter(L, lua.LNil),
-		co:        xEnv.Clone(L),
-		variables: make(map[string]string),
+		router:     xEnv.Prefix() + "/www/vhost",
+		handler:    xEnv.Prefix() + "/www/handle",
+		access:     cnn.Line,
+		r:          newRouter(L, lua.LNil),
+		co:         xEnv.Clone(L),
+		variables:  make(map[string]string),
+		serverName: velaServerHeader,
+		acl:        newACL(),
+		statusACL:  newACL(),
 	}
 
 	tab.Range(func(key string, val lua.LValue) {
@@ -55,14 +99,80 @@ func newConfig(L *lua.LState) *config {
 			cfg.name = val.String()
 		case "daemon":
 			cfg.daemon = val.String()
+		case "router":
+			cfg.router = val.String()
+		case "handler":
+			cfg.handler = val.String()
+		case "region":
+			cfg.region = val.String()
+		case "default", "not_found":
+			cfg.notFound = newHandleChainsL(val)
+		case "variables":
+			cfg.variablesL(L, val)
 		case "reuseport":
 			cfg.reuseport = val.String()
 		case "keepalive":
 			cfg.keepalive = val.String()
+		case "http2":
+			cfg.http2 = val.String()
+		case "h2c":
+			cfg.h2c = val.String()
 		case "bind":
-			cfg.bind = auxlib.CheckURL(val, L)
+			cfg.bindL(L, val)
+		case "cert":
+			cfg.cert = val.String()
+		case "key":
+			cfg.key = val.String()
 		case "output":
 			cfg.output = checkOutputSdk(L, val)
+		case "trace":
+			cfg.trace = checkOutputSdk(L, val)
+		case "rewrite", "access", "header_filter", "body_filter", "log":
+			cfg.phase.set(key, val)
+		case "drain_timeout":
+			cfg.drain = lua.IsInt(val)
+		case "proxy_protocol":
+			cfg.proxy = val.String()
+		case "proxy_trusted":
+			cfg.trusted = append(cfg.trusted, checkCIDR(L, val)...)
+		case "allow":
+			cfg.acl.Allow(checkCIDR(L, val)...)
+		case "deny":
+			cfg.acl.Deny(checkCIDR(L, val)...)
+		case "acl_log":
+			cfg.aclLog = val.String()
+		case "status":
+			cfg.status = val.String()
+		case "status_allow":
+			cfg.statusACL.Allow(checkCIDR(L, val)...)
+		case "request_id_header":
+			cfg.requestIDName = val.String()
+		case "request_id_trusted":
+			cfg.requestIDTrusted = append(cfg.requestIDTrusted, checkCIDR(L, val)...)
+		case "read_timeout":
+			cfg.readTimeout = lua.IsInt(val)
+		case "write_timeout":
+			cfg.writeTimeout = lua.IsInt(val)
+		case "idle_timeout":
+			cfg.idleTimeout = lua.IsInt(val)
+		case "max_request_body_size":
+			cfg.maxBodySize = lua.IsInt(val)
+		case "concurrency":
+			cfg.concurrency = lua.IsInt(val)
+		case "max_conns_per_ip":
+			cfg.maxConnsPerIP = lua.IsInt(val)
+		case "max_requests_per_conn":
+			cfg.maxReqPerConn = lua.IsInt(val)
+		case "read_buffer_size":
+			cfg.readBuffer = lua.IsInt(val)
+		case "write_buffer_size":
+			cfg.writeBuffer = lua.IsInt(val)
+		case "disable_header_normalizing":
+			cfg.noNormalizing = val.String()
+		case "reduce_memory_usage":
+			cfg.reduceMemory = val.String()
+		case "server_name":
+			cfg.serverName = val.String()
 
 		default:
 			L.RaiseError("invalid web config %s field", key)
@@ -77,10 +187,131 @@ func newConfig(L *lua.LState) *config {
 	return cfg
 }
 
+func (cfg *config) bindL(L *lua.LState, val lua.LValue) {
+	switch val.Type() {
+	case lua.LTTable:
+		for _, item := range auxlib.LTab2SS(val.(*lua.LTable)) {
+			cfg.bind = append(cfg.bind, auxlib.CheckURL(lua.S2L(item), L))
+		}
+	default:
+		cfg.bind = append(cfg.bind, auxlib.CheckURL(val, L))
+	}
+}
+
+// variablesL 支持 {app = "a"} 和 {"app=a"} 两种写法
+func (cfg *config) variablesL(L *lua.LState, val lua.LValue) {
+	tab, ok := val.(*lua.LTable)
+	if !ok {
+		L.RaiseError("invalid variables , must be table got %s", val.Type().String())
+		return
+	}
+
+	tab.ForEach(func(k lua.LValue, v lua.LValue) {
+		if k.Type() == lua.LTString {
+			cfg.variables[k.String()] = v.String()
+			return
+		}
+
+		key, item := auxlib.ParamLValue(v.String())
+		if item == nil {
+			L.RaiseError("invalid variable %s", v.String())
+			return
+		}
+		cfg.variables[key] = item.String()
+	})
+}
+
+func checkCIDR(L *lua.LState, val lua.LValue) []*net.IPNet {
+	var items []string
+	switch val.Type() {
+	case lua.LTTable:
+		items = auxlib.LTab2SS(val.(*lua.LTable))
+	default:
+		items = strings.Split(val.String(), ",")
+	}
+
+	var cidr []*net.IPNet
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		v, err := parseCIDR(item)
+		if err != nil {
+			L.RaiseError("%v", err)
+			return nil
+		}
+		cidr = append(cidr, v)
+	}
+	return cidr
+}
+
+func (cfg *config) secure() bool {
+	for _, bind := range cfg.bind {
+		if secureScheme(bind.Scheme()) {
+			return true
+		}
+	}
+	return false
+}
+
 func (cfg *config) verify() error {
 	if cfg.name == "" {
 		return errors.New("invalid name")
 	}
 
+	if len(cfg.bind) == 0 {
+		return errors.New("invalid bind")
+	}
+
+	if cfg.secure() && (cfg.cert == "" || cfg.key == "") {
+		return errors.New("tls bind must have cert and key")
+	}
+
+	if cfg.drain < 0 {
+		return fmt.Errorf("invalid drain_timeout %d", cfg.drain)
+	}
+
+	for key, val := range map[string]int{
+		"read_timeout":          cfg.readTimeout,
+		"write_timeout":         cfg.writeTimeout,
+		"idle_timeout":          cfg.idleTimeout,
+		"max_request_body_size": cfg.maxBodySize,
+		"concurrency":           cfg.concurrency,
+		"max_conns_per_ip":      cfg.maxConnsPerIP,
+		"max_requests_per_conn": cfg.maxReqPerConn,
+		"read_buffer_size":      cfg.readBuffer,
+		"write_buffer_size":     cfg.writeBuffer,
+	} {
+		if val < 0 {
+			return fmt.Errorf("invalid %s %d", key, val)
+		}
+	}
+
+	//小于一个请求头的缓存没有意义
+	if cfg.readBuffer > 0 && cfg.readBuffer < minBufferSize {
+		return fmt.Errorf("read_buffer_size must >= %d", minBufferSize)
+	}
+
+	if cfg.writeBuffer > 0 && cfg.writeBuffer < minBufferSize {
+		return fmt.Errorf("write_buffer_size must >= %d", minBufferSize)
+	}
+
 	return nil
 }
+
+// serverHeader 返回的server头 off表示不返回
+func (cfg *config) serverHeader() string {
+	if cfg.serverName == "off" {
+		return ""
+	}
+	return cfg.serverName
+}
+
+func (cfg *config) maxRequestBodySize() int {
+	if cfg.maxBodySize > 0 {
+		return cfg.maxBodySize
+	}
+	return fasthttp.DefaultMaxRequestBodySize
+}
@@ -0,0 +1,224 @@
+package fasthttp
+
+import (
+	"fmt"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var connSeq uint64
+
+// connInfo 每个连接的统计信息 on_connect on_close 和访问日志使用
+type connInfo struct {
+	id       uint64
+	remote   net.Addr
+	local    net.Addr
+	start    time.Time
+	requests uint64
+	rx       uint64
+	tx       uint64
+}
+
+func (ci *connInfo) String() string                         { return fmt.Sprintf("fasthttp.conn %d", ci.id) }
+func (ci *connInfo) Type() lua.LValueType                   { return lua.LTObject }
+func (ci *connInfo) AssertFloat64() (float64, bool)         { return 0, false }
+func (ci *connInfo) AssertString() (string, bool)           { return "", false }
+func (ci *connInfo) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (ci *connInfo) Peek() lua.LValue                       { return ci }
+
+func (ci *connInfo) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "id":
+		return lua.LNumber(ci.id)
+	case "remote_addr":
+		if ip := addrIP(ci.remote); ip != nil {
+			return lua.S2L(ip.String())
+		}
+		return lua.S2L(ci.remote.String())
+	case "remote_port":
+		return lua.LInt(xPort(ci.remote))
+	case "local_addr":
+		if ip := addrIP(ci.local); ip != nil {
+			return lua.S2L(ip.String())
+		}
+		return lua.S2L(ci.local.String())
+	case "local_port":
+		return lua.LInt(xPort(ci.local))
+	case "requests":
+		return lua.LNumber(atomic.LoadUint64(&ci.requests))
+	case "rx":
+		return lua.LNumber(atomic.LoadUint64(&ci.rx))
+	case "tx":
+		return lua.LNumber(atomic.LoadUint64(&ci.tx))
+	case "duration":
+		return lua.LNumber(time.Since(ci.start).Milliseconds())
+	}
+
+	return lua.LNil
+}
+
+// trackListener 给每个连接分配id 统计请求数和流量
+type trackListener struct {
+	net.Listener
+	fss       *server
+	keepalive bool
+}
+
+func newTrackListener(ln net.Listener, fss *server, keepalive bool) *trackListener {
+	return &trackListener{Listener: ln, fss: fss, keepalive: keepalive}
+}
+
+func (tl *trackListener) Accept() (net.Conn, error) {
+	c, err := tl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	//被PROXY协议等包装之后fasthttp无法设置keepalive
+	if _, ok := c.(*net.TCPConn); !ok && tl.keepalive {
+		tcp := findConn(c, func(c net.Conn) bool {
+			_, ok := c.(*net.TCPConn)
+			return ok
+		})
+
+		if tcp != nil {
+			_ = tcp.(*net.TCPConn).SetKeepAlive(true)
+		}
+	}
+
+	//没有on_connect on_close时不包装 保留*net.TCPConn给fasthttp使用sendfile
+	if !tl.fss.hooked() {
+		return c, nil
+	}
+
+	info := &connInfo{id: atomic.AddUint64(&connSeq, 1), start: time.Now()}
+	return &trackedConn{Conn: c, info: info, fss: tl.fss}, nil
+}
+
+// trackedConn 第一次读取时调用on_connect 在连接自己的协程中执行 不阻塞accept
+type trackedConn struct {
+	net.Conn
+	info *connInfo
+	fss  *server
+
+	open   sync.Once
+	closed sync.Once
+	opened int32
+	err    error
+}
+
+func (tc *trackedConn) connect() {
+	tc.open.Do(func() {
+		tc.info.remote = tc.Conn.RemoteAddr()
+		tc.info.local = tc.Conn.LocalAddr()
+		if !tc.fss.onConnect(tc.info) {
+			tc.err = connRejected
+			_ = tc.Close()
+			return
+		}
+		atomic.StoreInt32(&tc.opened, 1)
+	})
+}
+
+func (tc *trackedConn) Read(b []byte) (int, error) {
+	tc.connect()
+	if tc.err != nil {
+		return 0, tc.err
+	}
+
+	n, err := tc.Conn.Read(b)
+	atomic.AddUint64(&tc.info.rx, uint64(n))
+	return n, err
+}
+
+func (tc *trackedConn) Write(b []byte) (int, error) {
+	n, err := tc.Conn.Write(b)
+	atomic.AddUint64(&tc.info.tx, uint64(n))
+	return n, err
+}
+
+func (tc *trackedConn) Close() error {
+	err := tc.Conn.Close()
+	tc.closed.Do(func() {
+		//没有完成on_connect的连接不触发on_close
+		if atomic.LoadInt32(&tc.opened) == 1 {
+			tc.fss.onClose(tc.info)
+		}
+	})
+	return err
+}
+
+func (tc *trackedConn) NetConn() net.Conn {
+	return tc.Conn
+}
+
+// findConn 沿着tls等包装找到指定类型的连接
+func findConn(c net.Conn, match func(net.Conn) bool) net.Conn {
+	for c != nil {
+		if match(c) {
+			return c
+		}
+
+		nc, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil
+		}
+		c = nc.NetConn()
+	}
+	return nil
+}
+
+func connOf(ctx *RequestCtx) *connInfo {
+	c := findConn(ctx.Conn(), func(c net.Conn) bool {
+		_, ok := c.(*trackedConn)
+		return ok
+	})
+
+	if c == nil {
+		return nil
+	}
+	return c.(*trackedConn).info
+}
+
+func (fss *server) callConnHook(fn *lua.LFunction, info *connInfo) lua.LValue {
+	co := xEnv.Coroutine()
+	defer xEnv.Free(co)
+
+	cp := xEnv.P(fn)
+	cp.NRet = 1
+	if err := co.CallByParam(cp, info); err != nil {
+		xEnv.Errorf("%s web conn %d hook error %v", fss.Name(), info.id, err)
+		return lua.LNil
+	}
+
+	ret := co.Get(-1)
+	co.Pop(1)
+	return ret
+}
+
+// hooked 是否配置了连接的钩子
+func (fss *server) hooked() bool {
+	return fss.cfg.onConnect.Load() != nil || fss.cfg.onClose.Load() != nil
+}
+
+// onConnect 返回false拒绝连接
+func (fss *server) onConnect(info *connInfo) bool {
+	fn := fss.cfg.onConnect.Load()
+	if fn == nil {
+		return true
+	}
+
+	return fss.callConnHook(fn, info) != lua.LFalse
+}
+
+func (fss *server) onClose(info *connInfo) {
+	fn := fss.cfg.onClose.Load()
+	if fn == nil {
+		return
+	}
+
+	fss.callConnHook(fn, info)
+}
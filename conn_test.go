@@ -0,0 +1,47 @@
+package fasthttp
+
+import (
+	"github.com/vela-ssoc/vela-kit/lua"
+	"net"
+	"testing"
+)
+
+func TestTrackListenerWrap(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	fss := &server{cfg: &config{}}
+	tl := newTrackListener(ln, fss, true)
+
+	accept := func() net.Conn {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		conn, err := tl.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+
+	//没有钩子 fasthttp需要拿到原始的*net.TCPConn
+	conn := accept()
+	if _, ok := conn.(*net.TCPConn); !ok {
+		t.Fatalf("got %T , want *net.TCPConn", conn)
+	}
+	conn.Close()
+
+	fss.cfg.onClose.Store(&lua.LFunction{})
+	conn = accept()
+	tc, ok := conn.(*trackedConn)
+	if !ok {
+		t.Fatalf("got %T , want *trackedConn", conn)
+	}
+	tc.Conn.Close()
+}
@@ -2,6 +2,7 @@ package fasthttp
 
 import (
 	"github.com/vela-ssoc/vela-kit/lua"
+	"sync/atomic"
 )
 
 func (fss *server) Header(out lua.Console) {
@@ -14,11 +15,45 @@ func (fss *server) Header(out lua.Console) {
 func (fss *server) Show(out lua.Console) {
 	fss.Header(out)
 	out.Printf("name  = %s", fss.Name())
-	out.Printf("bind = %s", fss.cfg.bind.String())
+	if e := fss.lastError(); e != nil {
+		out.Printf("error = %v", e)
+	}
+	for i, bind := range fss.cfg.bind {
+		out.Printf("bind[%d] = %s", i, bind.String())
+	}
+	if fss.cfg.secure() {
+		out.Printf("cert = %s", fss.cfg.cert)
+		out.Printf("key = %s", fss.cfg.key)
+	}
+	out.Printf("http2 = %s", fss.cfg.http2)
+	out.Printf("h2c = %s", fss.cfg.h2c)
+	out.Printf("proxy_protocol = %s", fss.cfg.proxy)
+	out.Printf("server_name = %s", fss.cfg.serverName)
+	out.Printf("max_request_body_size = %d", fss.cfg.maxRequestBodySize())
+	out.Printf("concurrency = %d", fss.cfg.concurrency)
+	out.Printf("max_conns_per_ip = %d", fss.cfg.maxConnsPerIP)
+	out.Printf("acl_rejected = %d", fss.cfg.acl.Rejected())
+	out.Printf("status = %s", fss.cfg.status)
+	out.Printf("connections = %d", fss.activeConns())
+	out.Printf("inflight = %d", atomic.LoadInt64(&fss.inflight))
+	out.Printf("requests = %d", fss.stats.Requests())
 	out.Printf("routers = %s", fss.cfg.router)
 	out.Printf("handler = %s", fss.cfg.handler)
 	out.Printf("not_found = %s", fss.cfg.notFound)
 	out.Printf("output = %s", fss.cfg.output.Name())
+	out.Println("")
+
+	for i, l := range fss.listeners {
+		state, err := l.State()
+		if err != nil {
+			out.Printf("listener[%d] %s state:%s error:%v", i, l.bind.String(), state, err)
+			continue
+		}
+		out.Printf("listener[%d] %s state:%s", i, l.bind.String(), state)
+	}
+	out.Println("")
+
+	fss.showRoutes(out)
 }
 
 func (fss *server) Help(out lua.Console) {
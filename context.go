@@ -2,6 +2,7 @@ package fasthttp
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/vela-ssoc/vela-kit/auxlib"
@@ -11,6 +12,7 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -60,11 +62,14 @@ func newContext() *fsContext {
 }
 
 func xPort(addr net.Addr) int {
-	x, ok := addr.(*net.TCPAddr)
-	if !ok {
+	switch x := addr.(type) {
+	case *net.TCPAddr:
+		return x.Port
+	case *net.UDPAddr:
+		return x.Port
+	default:
 		return 0
 	}
-	return x.Port
 }
 
 func addr(ctx *RequestCtx) string {
@@ -201,13 +206,40 @@ func cloneL(co *lua.LState) int {
 	ctx := checkRequestCtx(co)
 	url := co.CheckString(1)
 
-	rsp, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.SetBodyString("clone fail")
+		return 0
+	}
+
+	//转发请求id
+	if id := requestIDOf(ctx); id != "" {
+		req.Header.Set(requestIDHeaderOf(ctx), id)
+	}
+
+	sp := startSpan(ctx, "clone", spanKindClient)
+	if sp != nil {
+		sp.Set("http.url", url)
+		req.Header.Set(traceParentHeader, sp.TraceParent())
+		if sp.state != "" {
+			req.Header.Set(traceStateHeader, sp.state)
+		}
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		sp.Error(err)
+		sp.End()
+		requestErrorf(ctx, "clone %s fail %v", url, err)
 		ctx.SetStatusCode(http.StatusInternalServerError)
 		ctx.SetBodyString("clone fail")
 		return 0
 	}
 
+	sp.Set("http.status_code", rsp.StatusCode)
+	sp.End()
+
 	for key, val := range rsp.Header {
 		for _, iv := range val {
 			ctx.Response.Header.Set(key, iv)
@@ -275,6 +307,8 @@ func k2v(ctx *RequestCtx, key string) lua.LValue {
 
 	case "method":
 		return lua.B2L(ctx.Method())
+	case "protocol":
+		return lua.B2L(ctx.Request.Header.Protocol())
 
 	//浏览器标识
 	case "ua":
@@ -286,6 +320,43 @@ func k2v(ctx *RequestCtx, key string) lua.LValue {
 	case "remote_port":
 		return lua.LInt(xPort(ctx.RemoteAddr()))
 
+	//请求id
+	case "request_id":
+		return lua.S2L(requestIDOf(ctx))
+
+	//链路id
+	case "trace_id":
+		if sp := spanOf(ctx); sp != nil {
+			return lua.S2L(hex.EncodeToString(sp.traceID[:]))
+		}
+		return lua.LNil
+
+	//连接信息
+	//连接编号和请求序号使用fasthttp的 是否配置连接钩子都一样
+	case "conn_id":
+		return lua.LNumber(ctx.ConnID())
+	case "conn_requests":
+		return lua.LNumber(ctx.ConnRequestNum())
+
+	//流量只有配置了on_connect on_close的连接才统计 否则为0
+	case "conn_rx":
+		if info := connOf(ctx); info != nil {
+			return lua.LNumber(atomic.LoadUint64(&info.rx))
+		}
+		return lua.LNumber(0)
+	case "conn_tx":
+		if info := connOf(ctx); info != nil {
+			return lua.LNumber(atomic.LoadUint64(&info.tx))
+		}
+		return lua.LNumber(0)
+
+	//PROXY协议下负载均衡的地址
+	case "proxy_addr":
+		if peer := proxyPeer(ctx); peer != nil {
+			return lua.S2L(peer.String())
+		}
+		return lua.LNil
+
 	//服务器信息
 	case "server_addr":
 		return lua.S2L(ctx.LocalIP().String())
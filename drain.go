@@ -0,0 +1,123 @@
+package fasthttp
+
+import (
+	"context"
+	"github.com/valyala/fasthttp"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var defaultDrainTimeout = 10 * time.Second
+
+// connTracker 记录fasthttp的活跃连接 超时后强制关闭
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{conns: make(map[net.Conn]struct{})}
+}
+
+func (ct *connTracker) ConnState(c net.Conn, state fasthttp.ConnState) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	switch state {
+	case fasthttp.StateNew:
+		ct.conns[c] = struct{}{}
+	case fasthttp.StateClosed, fasthttp.StateHijacked:
+		delete(ct.conns, c)
+	}
+}
+
+func (ct *connTracker) Len() int {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return len(ct.conns)
+}
+
+func (ct *connTracker) closeAll() int {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	n := len(ct.conns)
+	for c := range ct.conns {
+		_ = c.Close()
+		delete(ct.conns, c)
+	}
+	return n
+}
+
+func (fss *server) drainTimeout() time.Duration {
+	if fss.cfg.drain <= 0 {
+		return defaultDrainTimeout
+	}
+
+	return time.Duration(fss.cfg.drain) * time.Second
+}
+
+func (fss *server) drainProgress(stop chan struct{}) {
+	tk := time.NewTicker(time.Second)
+	defer tk.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tk.C:
+			xEnv.Errorf("%s web draining inflight:%d conns:%d", fss.Name(),
+				atomic.LoadInt64(&fss.inflight), fss.conns.Len())
+		}
+	}
+}
+
+func (fss *server) waitInflight(ctx context.Context) {
+	tk := time.NewTicker(100 * time.Millisecond)
+	defer tk.Stop()
+
+	for atomic.LoadInt64(&fss.inflight) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+		}
+	}
+}
+
+// drain 停止接收新连接 等待正在处理的请求完成 超时后强制关闭剩余连接
+func (fss *server) drain() {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), fss.drainTimeout())
+	defer cancel()
+
+	xEnv.Errorf("%s web drain start timeout:%s inflight:%d conns:%d", fss.Name(),
+		fss.drainTimeout(), atomic.LoadInt64(&fss.inflight), fss.conns.Len())
+
+	stop := make(chan struct{})
+	go fss.drainProgress(stop)
+
+	var wg sync.WaitGroup
+	for _, l := range fss.listeners {
+		wg.Add(1)
+		go func(l *listener) {
+			defer wg.Done()
+			l.shutdown(ctx)
+		}(l)
+	}
+
+	wg.Wait()
+	fss.waitInflight(ctx)
+	close(stop)
+
+	//按照实际关闭的数量输出 没有超时的时候也可能有空闲连接被关闭
+	forced := fss.conns.closeAll()
+	for _, l := range fss.listeners {
+		forced += l.closeActive()
+	}
+
+	xEnv.Errorf("%s web drain done in %s , forced close %d connections , abort %d requests", fss.Name(),
+		time.Since(start), forced, atomic.LoadInt64(&fss.inflight))
+}
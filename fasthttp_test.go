@@ -0,0 +1,21 @@
+package fasthttp
+
+import (
+	"testing"
+
+	"github.com/vela-ssoc/vela-kit/vela"
+)
+
+// testEnv 测试只需要日志 其他方法没有实现
+type testEnv struct {
+	vela.Environment
+	t *testing.T
+}
+
+func (e testEnv) Errorf(format string, args ...interface{}) {
+	e.t.Logf(format, args...)
+}
+
+func useTestEnv(t *testing.T) {
+	xEnv = testEnv{t: t}
+}
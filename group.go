@@ -0,0 +1,95 @@
+package fasthttp
+
+import (
+	"fmt"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"strings"
+)
+
+// routeGroup 路由分组 共享路径前缀和前置handle 可以嵌套
+type routeGroup struct {
+	r      *vRouter
+	prefix string
+	head   *HandleChains
+}
+
+func (g *routeGroup) String() string                         { return fmt.Sprintf("fasthttp.group %s", g.prefix) }
+func (g *routeGroup) Type() lua.LValueType                   { return lua.LTObject }
+func (g *routeGroup) AssertFloat64() (float64, bool)         { return 0, false }
+func (g *routeGroup) AssertString() (string, bool)           { return "", false }
+func (g *routeGroup) AssertFunction() (*lua.LFunction, bool) { return nil, false }
+func (g *routeGroup) Peek() lua.LValue                       { return g }
+
+// root 路由本身 没有前缀和前置handle
+func (r *vRouter) root() *routeGroup {
+	return &routeGroup{r: r}
+}
+
+func (g *routeGroup) path(path string) string {
+	if g.prefix == "" {
+		return path
+	}
+	return g.prefix + path
+}
+
+// chains 分组的handle放在路由handle前面
+func (g *routeGroup) chains(tail *HandleChains) *HandleChains {
+	return joinHandleChains(g.head, tail)
+}
+
+func joinHandleChains(head, tail *HandleChains) *HandleChains {
+	if head == nil || head.cap == 0 {
+		return tail
+	}
+
+	if tail == nil || tail.cap == 0 {
+		return head
+	}
+
+	hc := newHandleChains(head.cap + tail.cap)
+	copy(hc.data, head.data[:head.cap])
+	copy(hc.mask, head.mask[:head.cap])
+	copy(hc.data[head.cap:], tail.data[:tail.cap])
+	copy(hc.mask[head.cap:], tail.mask[:tail.cap])
+	return hc
+}
+
+// groupIndexFn r.group(prefix , handle...) 返回子路由
+func (g *routeGroup) groupIndexFn(L *lua.LState) *lua.LFunction {
+	fn := func(co *lua.LState) int {
+		prefix := strings.TrimSuffix(co.CheckString(1), "/")
+		if prefix != "" && prefix[0] != '/' {
+			co.RaiseError("group prefix must begin with '/' in path '%s'", prefix)
+			return 0
+		}
+
+		sub := &routeGroup{r: g.r, prefix: g.prefix + prefix, head: g.head}
+		if co.GetTop() > 1 {
+			sub.head = g.chains(checkHandleChains(co, 1))
+		}
+		co.Push(sub)
+		return 1
+	}
+	return L.NewFunction(fn)
+}
+
+func (g *routeGroup) Index(L *lua.LState, key string) lua.LValue {
+	switch key {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE":
+		return g.handleIndexFn(L, key)
+
+	case "FILE", "file":
+		return g.fileIndexFn(L)
+
+	case "ANY", "any":
+		return g.anyIndexFn(L)
+
+	case "group":
+		return g.groupIndexFn(L)
+
+	case "prefix":
+		return lua.S2L(g.prefix)
+	}
+
+	return lua.LNil
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/valyala/fasthttp"
 	cond "github.com/vela-ssoc/vela-cond"
 	"github.com/vela-ssoc/vela-kit/lua"
+	"strconv"
+	"strings"
 	"sync/atomic"
 )
 
@@ -15,8 +17,9 @@ const (
 )
 
 var (
-	emptyHandle      = errors.New("empty handle object")
-	velaServerHeader = "vela-fasthttp v2.0"
+	emptyHandle       = errors.New("empty handle object")
+	invalidHandleType = errors.New("invalid handle type")
+	velaServerHeader  = "vela-fasthttp v2.0"
 )
 
 type handleType int
@@ -29,7 +32,7 @@ type handle struct {
 	//业务字段
 	count  uint32
 	cnd    *cond.Cond
-	method string
+	method methodSet
 
 	//返回包处理
 	code   int
@@ -39,6 +42,9 @@ type handle struct {
 	//返回结果
 	body func(*RequestCtx) error
 
+	//web.proxy的上游 关闭时释放空闲连接
+	up *upstream
+
 	//结束匹配
 	eof bool
 }
@@ -48,6 +54,10 @@ func newHandle(name string) *handle {
 }
 
 func (hd *handle) Close() error {
+	if hd.up != nil {
+		hd.up.close()
+	}
+
 	if hd.close == nil {
 		return nil
 	}
@@ -69,6 +79,11 @@ func (hd *handle) Match(v string) bool {
 }
 
 func (hd *handle) filter(ctx *RequestCtx) bool {
+	//请求方法不匹配和filter没有命中一样跳过
+	if !hd.method.match(ctx) {
+		return false
+	}
+
 	if hd.cnd == nil {
 		return true
 	}
@@ -76,7 +91,8 @@ func (hd *handle) filter(ctx *RequestCtx) bool {
 	return hd.cnd.Match(ctx)
 }
 
-func (hd *handle) do(co *lua.LState, ctx *RequestCtx, eof *bool) error {
+// do phase为true时在请求阶段中执行 带响应体的handle按照eof结束阶段 路由中保持原来的行为
+func (hd *handle) do(co *lua.LState, ctx *RequestCtx, eof *bool, phase bool) error {
 	atomic.AddUint32(&hd.count, 1)
 
 	if hd.filter(ctx) {
@@ -90,7 +106,9 @@ func (hd *handle) do(co *lua.LState, ctx *RequestCtx, eof *bool) error {
 
 set:
 	//设置header
-	ctx.Response.Header.Set("server", velaServerHeader)
+	if name := serverHeader(ctx); name != "" {
+		ctx.Response.Header.Set("server", name)
+	}
 	if hd.header != nil {
 		hd.header.ForEach(func(key string, val string) {
 			ctx.Response.Header.Set(key, val)
@@ -109,7 +127,13 @@ set:
 
 	//设置响应体
 	if hd.body != nil {
-		return hd.body(ctx)
+		if err := hd.body(ctx); err != nil {
+			return err
+		}
+		if phase {
+			*eof = hd.eof
+		}
+		return nil
 	}
 	*eof = true
 
@@ -117,9 +141,10 @@ set:
 }
 
 type HandleChains struct {
-	data []interface{}
-	mask []handleType
-	cap  int
+	data  []interface{}
+	mask  []handleType
+	cap   int
+	phase bool //请求阶段的handle链
 }
 
 func newHandleChains(cap int) *HandleChains {
@@ -133,6 +158,30 @@ func newHandleChains(cap int) *HandleChains {
 	return hc
 }
 
+// StoreL 按照lua值的类型保存
+func (hc *HandleChains) StoreL(val lua.LValue, offset int) {
+	switch val.Type() {
+
+	//判断是否为加载
+	case lua.LTString:
+		hc.Store(val.String(), VHSTRING, offset)
+
+	case lua.LTObject:
+		hd, ok := val.(*handle)
+		if ok {
+			hc.Store(hd, VHANDLER, offset)
+		} else {
+			hc.Store(val.String(), VHSTRING, offset)
+		}
+
+	case lua.LTFunction:
+		hc.Store(val.(*lua.LFunction), VHFUNC, offset)
+
+	default:
+		hc.Store(val.String(), VHSTRING, offset)
+	}
+}
+
 func (hc *HandleChains) Store(v interface{}, mask handleType, offset int) {
 	if offset > hc.cap {
 		xEnv.Errorf("vHandle overflower , cap:%d , got: %d", hc.cap, offset)
@@ -152,63 +201,110 @@ func (hc *HandleChains) notFound(ctx *RequestCtx) {
 }
 
 func (hc *HandleChains) invalid(ctx *RequestCtx, body string) {
+	requestErrorf(ctx, "handle %s error %s", ctx.Path(), body)
 	ctx.Response.SetStatusCode(fasthttp.StatusInternalServerError)
 	ctx.Response.SetBodyString(body)
 }
 
+// name 第i个handle的描述 trace和路由列表使用
+func (hc *HandleChains) name(i int) string {
+	switch hc.mask[i] {
+	case VHSTRING:
+		return "handle " + hc.data[i].(string)
+	case VHANDLER:
+		if name := hc.data[i].(*handle).name; name != "" {
+			return "handle " + name
+		}
+		return "handle #" + strconv.Itoa(i)
+	case VHFUNC:
+		return "function #" + strconv.Itoa(i)
+	}
+	return "invalid #" + strconv.Itoa(i)
+}
+
+func (hc *HandleChains) Names() []string {
+	if hc == nil {
+		return nil
+	}
+
+	names := make([]string, 0, hc.cap)
+	for i := 0; i < hc.cap; i++ {
+		names = append(names, hc.name(i))
+	}
+	return names
+}
+
+func (hc *HandleChains) String() string {
+	return strings.Join(hc.Names(), ",")
+}
+
+// call 执行第i个handle
+func (hc *HandleChains) call(co *lua.LState, ctx *RequestCtx, path string, i int, eof *bool) error {
+	switch hc.mask[i] {
+
+	//字符串
+	case VHSTRING:
+		item, err := requireHandle(path, hc.data[i].(string))
+		if err != nil {
+			return err
+		}
+		return item.do(co, ctx, eof, hc.phase)
+
+	//处理对象
+	case VHANDLER:
+		return hc.data[i].(*handle).do(co, ctx, eof, hc.phase)
+
+	case VHFUNC:
+		return co.CallByParam(xEnv.P(hc.data[i].(*lua.LFunction)))
+
+	//异常
+	default:
+		return invalidHandleType
+	}
+}
+
+// closeUpstreams 释放链中web.proxy的空闲连接 公共handle由handlePool关闭
+func (hc *HandleChains) closeUpstreams() {
+	if hc == nil {
+		return
+	}
+
+	for i := 0; i < hc.cap; i++ {
+		if hd, ok := hc.data[i].(*handle); ok && hd.up != nil {
+			hd.up.close()
+		}
+	}
+}
+
 func (hc *HandleChains) do(ctx *RequestCtx, path string) { //path handle 查找路径
 	if hc.cap == 0 {
 		hc.notFound(ctx)
 		return
 	}
 
-	var item *handle
-	var err error
+	hc.run(ctx, path)
+}
+
+// run 依次执行handle 出错或者eof结束时返回true
+func (hc *HandleChains) run(ctx *RequestCtx, path string) bool {
 	var eof bool
 
 	co := newLuaThread(ctx)
 	for i := 0; i < hc.cap; i++ {
-		switch hc.mask[i] {
-
-		//字符串
-		case VHSTRING:
-			item, err = requireHandle(path, hc.data[i].(string))
-			if err != nil {
-				hc.invalid(ctx, err.Error())
-				return
-			}
-
-			err = item.do(co, ctx, &eof)
-			if err != nil {
-				hc.invalid(ctx, err.Error())
-				return
-			}
-
-		//处理对象
-		case VHANDLER:
-			item = hc.data[i].(*handle)
-			err = item.do(co, ctx, &eof)
-			if err != nil {
-				hc.invalid(ctx, err.Error())
-				return
-			}
-
-		case VHFUNC:
-			cp := xEnv.P(hc.data[i].(*lua.LFunction))
-			if e := co.CallByParam(cp); e != nil {
-				hc.invalid(ctx, e.Error())
-				return
-			}
-
-		//异常
-		default:
-			hc.invalid(ctx, "invalid handle type")
-			return
+		sp := startSpan(ctx, hc.name(i), spanKindInternal)
+		err := hc.call(co, ctx, path, i, &eof)
+		sp.Error(err)
+		sp.End()
+
+		if err != nil {
+			hc.invalid(ctx, err.Error())
+			return true
 		}
 
 		if eof || checkLuaEof(ctx) {
-			return
+			return true
 		}
 
 	}
+	return false
 }
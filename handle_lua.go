@@ -29,7 +29,7 @@ func (hd *handle) filterL(lv lua.LValue) {
 func (hd *handle) NewIndex(L *lua.LState, key string, val lua.LValue) {
 	switch key {
 	case "method":
-		hd.method = val.String()
+		hd.method = checkMethodSet(L, val)
 	case "filter":
 		hd.filterL(val)
 
@@ -88,6 +88,19 @@ func newLuaRedirectL(L *lua.LState) int {
 	return 1
 }
 
+// newLuaMetricsL prometheus指标 可以挂到任意路由上
+func newLuaMetricsL(L *lua.LState) int {
+	hd := newHandle("")
+	hd.code = http.StatusOK
+	hd.body = func(ctx *RequestCtx) error {
+		metricsHandler(ctx)
+		return nil
+	}
+	hd.eof = true
+	L.Push(hd)
+	return 1
+}
+
 func newLuaCloneL(L *lua.LState) int {
 	url := L.CheckString(1)
 	hd := newHandle("")
@@ -0,0 +1,154 @@
+package fasthttp
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+type hostKind int
+
+// vhost主机名类型 优先级:精确 前缀通配 后缀通配 正则
+const (
+	hostExact hostKind = iota
+	hostLeading
+	hostTrailing
+	hostRegex
+)
+
+// hostSeq 正则按照声明顺序匹配
+var hostSeq uint64
+
+// hostPattern vhost主机名 *.example.com www.example.* ~^api\d+\.example\.com$
+type hostPattern struct {
+	kind hostKind
+	name string
+	text string //通配去掉*之后的部分
+	re   *regexp.Regexp
+	seq  uint64
+}
+
+// normalizeHost 去掉端口和末尾的点 转成小写
+func normalizeHost(host string) string {
+	if strings.HasPrefix(host, "[") {
+		//ipv6 [::1]:8080
+		if i := strings.IndexByte(host, ']'); i > 0 {
+			host = host[:i+1]
+		}
+	} else if i := strings.LastIndexByte(host, ':'); i >= 0 && strings.IndexByte(host, ':') == i {
+		host = host[:i]
+	}
+
+	host = strings.TrimSuffix(host, ".")
+	return strings.ToLower(host)
+}
+
+// compileHost 解析vhost主机名 非法的通配和正则返回错误
+func compileHost(name string) (*hostPattern, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("invalid hostname")
+	}
+
+	if strings.HasPrefix(name, "~") {
+		re, err := regexp.Compile("(?i)" + name[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostname regex %s %v", name, err)
+		}
+		return &hostPattern{kind: hostRegex, name: name, re: re, seq: atomic.AddUint64(&hostSeq, 1)}, nil
+	}
+
+	name = normalizeHost(name)
+	n := strings.Count(name, "*")
+	switch {
+	case n == 0:
+		return &hostPattern{kind: hostExact, name: name}, nil
+
+	case n == 1 && strings.HasPrefix(name, "*.") && len(name) > 2:
+		return &hostPattern{kind: hostLeading, name: name, text: name[1:]}, nil
+
+	case n == 1 && strings.HasSuffix(name, ".*") && len(name) > 2:
+		return &hostPattern{kind: hostTrailing, name: name, text: name[:len(name)-1]}, nil
+
+	default:
+		return nil, fmt.Errorf("invalid hostname wildcard %s", name)
+	}
+}
+
+// match host需要先经过normalizeHost
+func (hp *hostPattern) match(host string) bool {
+	switch hp.kind {
+	case hostExact:
+		return hp.name == host
+	case hostLeading:
+		return len(host) > len(hp.text) && strings.HasSuffix(host, hp.text)
+	case hostTrailing:
+		return len(host) > len(hp.text) && strings.HasPrefix(host, hp.text)
+	case hostRegex:
+		return hp.re.MatchString(host)
+	default:
+		return false
+	}
+}
+
+// prefer 同时命中时是否优先于other 通配越长越优先 正则先声明的优先
+func (hp *hostPattern) prefer(other *hostPattern) bool {
+	if hp.kind != other.kind {
+		return hp.kind < other.kind
+	}
+
+	switch hp.kind {
+	case hostLeading, hostTrailing:
+		return len(hp.text) > len(other.text)
+	case hostRegex:
+		return hp.seq < other.seq
+	default:
+		return false
+	}
+}
+
+// lookupVhost 精确匹配 再按照通配和正则模糊匹配
+func (fss *server) lookupVhost(host string) *vRouter {
+	if item := fss.vhost.Get(host); item != nil {
+		if r, ok := item.val.(*vRouter); ok && r.host != nil && r.host.kind == hostExact {
+			return r
+		}
+	}
+
+	if item := fss.vhost.Grep(host); item != nil {
+		return item.val.(*vRouter)
+	}
+	return nil
+}
+
+// hostKey vhost在pool中的key 和compileHost保持一致
+func hostKey(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "~") {
+		return name
+	}
+	return normalizeHost(name)
+}
+
+// addVhost 编译主机名后加入vhost
+func (fss *server) addVhost(hostname string, r *vRouter) error {
+	hp, err := compileHost(hostname)
+	if err != nil {
+		return err
+	}
+
+	//替换已有的正则vhost时保留原来的声明顺序
+	if hp.kind == hostRegex {
+		if item := fss.vhost.Get(hp.name); item != nil {
+			if old, ok := item.val.(*vRouter); ok && old.host != nil {
+				hp.seq = old.host.seq
+			}
+		}
+	}
+
+	r.host = hp
+	r.vhost = hp.name
+	fss.vhost.insert(hp.name, r)
+	return nil
+}
@@ -0,0 +1,25 @@
+package fasthttp
+
+import "testing"
+
+func TestVhostRegexKeepSeq(t *testing.T) {
+	useTestEnv(t)
+
+	fss := &server{vhost: newPool()}
+	add := func(name string) *vRouter {
+		r := &vRouter{}
+		if err := fss.addVhost(name, r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	add(`~^api`)
+	add(`~^a`)
+
+	//重新加载先声明的vhost 仍然优先于后声明的
+	r := add(`~^api`)
+	if got := fss.lookupVhost("api.example.com"); got != r {
+		t.Fatalf("got %v want %v", got.vhost, r.vhost)
+	}
+}
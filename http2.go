@@ -0,0 +1,224 @@
+package fasthttp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"golang.org/x/net/http2"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	h2cPreface       = []byte(http2.ClientPreface)
+	h2HandshakeLimit = 10 * time.Second
+)
+
+type peekConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (pc *peekConn) Read(b []byte) (int, error) {
+	return pc.r.Read(b)
+}
+
+func (pc *peekConn) NetConn() net.Conn {
+	return pc.Conn
+}
+
+// peekPreface 逐步比较完整的h2c preface 第一个不一致的字节就返回 较短的HTTP/1请求不会等到超时
+func peekPreface(r *bufio.Reader) (bool, error) {
+	n := 1
+	for {
+		head, err := r.Peek(n)
+		if err != nil {
+			return false, err
+		}
+
+		//已经读到的数据一起比较
+		if size := r.Buffered(); size > n {
+			if size > len(h2cPreface) {
+				size = len(h2cPreface)
+			}
+			head, _ = r.Peek(size)
+		}
+
+		if !bytes.Equal(head, h2cPreface[:len(head)]) {
+			return false, nil
+		}
+
+		if len(head) == len(h2cPreface) {
+			return true, nil
+		}
+		n = len(head) + 1
+	}
+}
+
+// h2Listener 在accept阶段分流 h2连接交给http2.Server 其余的交给fasthttp
+type h2Listener struct {
+	net.Listener
+
+	owner *listener
+	h2    *http2.Server
+	hs    *http.Server
+	h2c   bool
+
+	conn chan net.Conn
+	done chan struct{}
+	err  error
+	once sync.Once
+
+	mu     sync.Mutex
+	active map[net.Conn]struct{}
+}
+
+func newH2Listener(owner *listener, ln net.Listener) *h2Listener {
+	l := &h2Listener{
+		Listener: ln,
+		owner:    owner,
+		h2:       &http2.Server{IdleTimeout: owner.timeout("idle_timeout")},
+		hs:       &http.Server{},
+		h2c:      owner.option("h2c") == "on",
+		conn:     make(chan net.Conn),
+		done:     make(chan struct{}),
+		active:   make(map[net.Conn]struct{}),
+	}
+
+	//注册优雅关闭 drain时发送GOAWAY
+	if e := http2.ConfigureServer(l.hs, l.h2); e != nil {
+		xEnv.Errorf("%s web http2 configure error %v", owner.fss.Name(), e)
+	}
+
+	go l.accept()
+	return l
+}
+
+func (l *h2Listener) accept() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			l.shutdown(err)
+			return
+		}
+
+		go l.dispatch(c)
+	}
+}
+
+func (l *h2Listener) dispatch(c net.Conn) {
+	switch tc := c.(type) {
+	case *tls.Conn:
+		_ = tc.SetDeadline(time.Now().Add(h2HandshakeLimit))
+		if err := tc.Handshake(); err != nil {
+			_ = c.Close()
+			return
+		}
+		_ = tc.SetDeadline(time.Time{})
+
+		if tc.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+			l.serve(c)
+			return
+		}
+
+	default:
+		if !l.h2c {
+			break
+		}
+
+		pc := &peekConn{Conn: c, r: bufio.NewReader(c)}
+		_ = c.SetReadDeadline(time.Now().Add(h2HandshakeLimit))
+		h2c, err := peekPreface(pc.r)
+		if err != nil {
+			_ = c.Close()
+			return
+		}
+		_ = c.SetReadDeadline(time.Time{})
+
+		c = pc
+		//prior knowledge h2c
+		if h2c {
+			l.serve(c)
+			return
+		}
+	}
+
+	select {
+	case l.conn <- c:
+	case <-l.done:
+		_ = c.Close()
+	}
+}
+
+func (l *h2Listener) serve(c net.Conn) {
+	l.mu.Lock()
+	l.active[c] = struct{}{}
+	l.mu.Unlock()
+
+	l.h2.ServeConn(c, &http2.ServeConnOpts{Handler: l.owner.fss.adaptor(c, l.owner.Handler), BaseConfig: l.hs})
+
+	l.mu.Lock()
+	delete(l.active, c)
+	l.mu.Unlock()
+}
+
+func (l *h2Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conn:
+		return c, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *h2Listener) shutdown(err error) {
+	l.once.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+func (l *h2Listener) Close() error {
+	err := l.Listener.Close()
+	l.shutdown(net.ErrClosed)
+	return err
+}
+
+func (l *h2Listener) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.active)
+}
+
+// drain 通知h2连接GOAWAY 等待活跃连接结束
+func (l *h2Listener) drain(ctx context.Context) {
+	_ = l.hs.Shutdown(ctx)
+
+	tk := time.NewTicker(100 * time.Millisecond)
+	defer tk.Stop()
+
+	for l.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tk.C:
+		}
+	}
+}
+
+func (l *h2Listener) closeActive() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := len(l.active)
+	for c := range l.active {
+		_ = c.Close()
+	}
+	return n
+}
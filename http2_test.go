@@ -0,0 +1,36 @@
+package fasthttp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestPeekPreface(t *testing.T) {
+	cases := []struct {
+		data string
+		h2c  bool
+	}{
+		{"PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", true},
+		{"PRI / HTTP/1.1\r\nHost: a\r\n\r\n", false},
+		{"PRI * HTTP/1.1\r\nHost: a\r\n\r\n", false},
+		{"GET / HTTP/1.0\r\n\r\n", false},
+	}
+
+	for _, c := range cases {
+		r := bufio.NewReader(strings.NewReader(c.data))
+		h2c, err := peekPreface(r)
+		if err != nil {
+			t.Fatalf("%q error %v", c.data, err)
+		}
+
+		if h2c != c.h2c {
+			t.Errorf("%q got %v want %v", c.data, h2c, c.h2c)
+		}
+
+		//只能peek 不能消费数据
+		if r.Buffered() == 0 {
+			t.Errorf("%q consumed", c.data)
+		}
+	}
+}
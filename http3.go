@@ -0,0 +1,115 @@
+package fasthttp
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/quic-go/quic-go/http3"
+	"net"
+	"net/http"
+	"time"
+)
+
+var (
+	invalidQuicConn = errors.New("quic stream not support raw conn")
+)
+
+// quicConn 只提供地址和tls信息 让RequestCtx的RemoteAddr和IsTLS正常工作
+type quicConn struct {
+	local  net.Addr
+	remote net.Addr
+	state  tls.ConnectionState
+}
+
+func newQuicConn(r *http.Request) *quicConn {
+	qc := &quicConn{local: zeroUDPAddr, remote: zeroUDPAddr}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		qc.local = addr
+	}
+
+	if addr, ok := r.Context().Value(http3.RemoteAddrContextKey).(net.Addr); ok {
+		qc.remote = addr
+	}
+
+	if r.TLS != nil {
+		qc.state = *r.TLS
+	}
+	return qc
+}
+
+var zeroUDPAddr = &net.UDPAddr{IP: net.IPv4zero}
+
+func (qc *quicConn) Read(b []byte) (int, error)         { return 0, invalidQuicConn }
+func (qc *quicConn) Write(b []byte) (int, error)        { return 0, invalidQuicConn }
+func (qc *quicConn) Close() error                       { return nil }
+func (qc *quicConn) LocalAddr() net.Addr                { return qc.local }
+func (qc *quicConn) RemoteAddr() net.Addr               { return qc.remote }
+func (qc *quicConn) SetDeadline(t time.Time) error      { return nil }
+func (qc *quicConn) SetReadDeadline(t time.Time) error  { return nil }
+func (qc *quicConn) SetWriteDeadline(t time.Time) error { return nil }
+func (qc *quicConn) Handshake() error                   { return nil }
+func (qc *quicConn) ConnectionState() tls.ConnectionState {
+	return qc.state
+}
+
+func (l *listener) ServeHTTP3(w http.ResponseWriter, r *http.Request) {
+	qc := newQuicConn(r)
+
+	//quic没有accept阶段 在请求进入handler之前检查
+	if !l.fss.permit(qc.remote, qc.local) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	l.fss.adaptor(qc, l.fss.Handler)(w, r)
+}
+
+func (l *listener) listenQuic() error {
+	conn, err := net.ListenPacket("udp", l.bind.Host())
+	if err != nil {
+		return err
+	}
+
+	h3 := &http3.Server{
+		Handler:     http.HandlerFunc(l.ServeHTTP3),
+		TLSConfig:   http3.ConfigureTLSConfig(l.fss.tlsConfig(false)),
+		IdleTimeout: l.timeout("idle_timeout"),
+	}
+	l.udp = conn
+	l.h3 = h3
+
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		l.altSvc = fmt.Sprintf(`%s=":%d"; ma=86400`, http3.NextProtoH3, addr.Port)
+	}
+
+	go func() {
+		if e := h3.Serve(conn); e != nil && !errors.Is(e, http.ErrServerClosed) {
+			l.fail(e)
+		}
+	}()
+
+	return nil
+}
+
+func (l *listener) closeQuic() {
+	if l.h3 != nil {
+		_ = l.h3.Close()
+	}
+
+	if l.udp != nil {
+		_ = l.udp.Close()
+	}
+
+	l.udp = nil
+	l.h3 = nil
+	l.altSvc = ""
+}
+
+// advertise 在tcp监听上通告h3
+func (l *listener) advertise(ctx *RequestCtx) {
+	if l.altSvc == "" {
+		return
+	}
+
+	ctx.Response.Header.Set("Alt-Svc", l.altSvc)
+}
@@ -0,0 +1,146 @@
+package fasthttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/vela-ssoc/vela-kit/auxlib"
+)
+
+// selfSigned 127.0.0.1的自签名证书 返回证书和私钥路径
+func selfSigned(t *testing.T) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kb}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return certFile, keyFile, roots
+}
+
+func TestHTTP3(t *testing.T) {
+	useTestEnv(t)
+
+	certFile, keyFile, roots := selfSigned(t)
+	bind, err := auxlib.NewURL("quic://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fss := newServer(&config{
+		name:       "h3",
+		bind:       []auxlib.URL{bind},
+		cert:       certFile,
+		key:        keyFile,
+		variables:  map[string]string{},
+		acl:        newACL(),
+		statusACL:  newACL(),
+		serverName: velaServerHeader,
+	})
+
+	//路由直接使用go的处理函数 不依赖lua
+	r := &vRouter{r: router.New()}
+	r.r.GET("/hello", func(ctx *RequestCtx) {
+		ctx.SetBodyString("hello " + string(ctx.Request.Header.Protocol()))
+	})
+	if err = fss.addVhost("127.0.0.1", r); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = fss.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer fss.Close()
+
+	l := fss.listeners[0]
+	udp := l.udp.LocalAddr().(*net.UDPAddr)
+	tlsc := &tls.Config{RootCAs: roots}
+
+	//tcp上的响应通告h3
+	hc := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsc}}
+	rsp, err := hc.Get("https://" + l.ln.Addr().String() + "/hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = rsp.Body.Close()
+
+	want := fmt.Sprintf(`h3=":%d"; ma=86400`, udp.Port)
+	if got := rsp.Header.Get("Alt-Svc"); got != want {
+		t.Fatalf("Alt-Svc got %q want %q", got, want)
+	}
+
+	rt := &http3.RoundTripper{TLSClientConfig: tlsc}
+	defer rt.Close()
+
+	rsp, err = (&http.Client{Transport: rt, Timeout: 5 * time.Second}).Get(fmt.Sprintf("https://127.0.0.1:%d/hello", udp.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.ProtoMajor != 3 {
+		t.Errorf("proto got %s want HTTP/3", rsp.Proto)
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("status got %d want 200", rsp.StatusCode)
+	}
+
+	if string(body) != "hello HTTP/3.0" {
+		t.Errorf("body got %q", body)
+	}
+}
@@ -0,0 +1,235 @@
+package fasthttp
+
+import (
+	"github.com/valyala/fasthttp/reuseport"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 服务关闭后监听保留一段时间 等待相同bind的新实例接管
+var handoffTimeout = 5 * time.Second
+
+var inherited = &inheritTable{items: make(map[string]*inheritEntry)}
+
+type inheritEntry struct {
+	key     string
+	ln      net.Listener
+	pending []net.Conn
+	owned   bool
+	timer   *time.Timer
+}
+
+// inheritTable 进程内可以接管的监听 包括systemd传递的LISTEN_FDS
+type inheritTable struct {
+	once  sync.Once
+	mu    sync.Mutex
+	items map[string]*inheritEntry
+}
+
+func inheritKey(network, address string) string {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return network + "://" + address
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "tcp://" + address
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = ""
+	}
+
+	return "tcp://" + net.JoinHostPort(host, port)
+}
+
+// systemd 传递的监听从fd 3开始
+func (it *inheritTable) systemd() {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return
+	}
+
+	_ = os.Unsetenv("LISTEN_PID")
+	_ = os.Unsetenv("LISTEN_FDS")
+	_ = os.Unsetenv("LISTEN_FDNAMES")
+
+	for fd := 3; fd < 3+n; fd++ {
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		ln, e := net.FileListener(file)
+		_ = file.Close()
+		if e != nil {
+			xEnv.Errorf("inherit listen fd %d fail %v", fd, e)
+			continue
+		}
+
+		key := inheritKey(ln.Addr().Network(), ln.Addr().String())
+		it.items[key] = &inheritEntry{key: key, ln: ln}
+		xEnv.Errorf("inherit listen fd %d %s", fd, key)
+	}
+}
+
+// listen 优先接管已有的监听 没有就新建
+func (it *inheritTable) listen(network, address string, reuse bool) (net.Listener, error) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	it.once.Do(it.systemd)
+
+	key := inheritKey(network, address)
+	if e, ok := it.items[key]; ok && !e.owned {
+		if e.timer != nil {
+			e.timer.Stop()
+			e.timer = nil
+		}
+
+		if d, ok := e.ln.(interface{ SetDeadline(time.Time) error }); ok {
+			_ = d.SetDeadline(time.Time{})
+		}
+
+		e.owned = true
+		return &keepListener{Listener: e.ln, entry: e, closed: make(chan struct{})}, nil
+	}
+
+	var ln net.Listener
+	var err error
+	if reuse {
+		ln, err = reuseport.Listen(network, address)
+	} else {
+		ln, err = net.Listen(network, address)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	//已经被其他实例占用(reuseport) 不参与接管
+	if _, ok := it.items[key]; ok {
+		return ln, nil
+	}
+
+	e := &inheritEntry{key: key, ln: ln, owned: true}
+	it.items[key] = e
+	return &keepListener{Listener: ln, entry: e, closed: make(chan struct{})}, nil
+}
+
+func (it *inheritTable) park(e *inheritEntry) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	e.owned = false
+	e.timer = time.AfterFunc(handoffTimeout, func() { it.expire(e) })
+}
+
+func (it *inheritTable) hold(e *inheritEntry, c net.Conn) {
+	it.mu.Lock()
+	e.pending = append(e.pending, c)
+	it.mu.Unlock()
+}
+
+func (it *inheritTable) take(e *inheritEntry) net.Conn {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if len(e.pending) == 0 {
+		return nil
+	}
+
+	c := e.pending[0]
+	e.pending = e.pending[1:]
+	return c
+}
+
+// expire 超时没有被接管 真正关闭监听
+func (it *inheritTable) expire(e *inheritEntry) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+
+	if e.owned || it.items[e.key] != e {
+		return
+	}
+
+	it.close(e)
+}
+
+func (it *inheritTable) remove(e *inheritEntry) {
+	it.mu.Lock()
+	defer it.mu.Unlock()
+	it.close(e)
+}
+
+func (it *inheritTable) close(e *inheritEntry) {
+	if it.items[e.key] == e {
+		delete(it.items, e.key)
+	}
+
+	for _, c := range e.pending {
+		_ = c.Close()
+	}
+	e.pending = nil
+	_ = e.ln.Close()
+}
+
+// keepListener Close的时候不关闭底层socket 交给inheritTable保留
+type keepListener struct {
+	net.Listener
+	entry  *inheritEntry
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (kl *keepListener) isClosed() bool {
+	select {
+	case <-kl.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (kl *keepListener) Accept() (net.Conn, error) {
+	if kl.isClosed() {
+		return nil, net.ErrClosed
+	}
+
+	if c := inherited.take(kl.entry); c != nil {
+		return c, nil
+	}
+
+	c, err := kl.Listener.Accept()
+	if !kl.isClosed() {
+		return c, err
+	}
+
+	//关闭过程中收到的连接留给下一个实例
+	if err == nil {
+		inherited.hold(kl.entry, c)
+	}
+	return nil, net.ErrClosed
+}
+
+func (kl *keepListener) Close() error {
+	kl.once.Do(func() {
+		close(kl.closed)
+
+		d, ok := kl.Listener.(interface{ SetDeadline(time.Time) error })
+		if !ok {
+			inherited.remove(kl.entry)
+			return
+		}
+
+		//唤醒阻塞的Accept
+		_ = d.SetDeadline(time.Now())
+		inherited.park(kl.entry)
+	})
+	return nil
+}
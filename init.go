@@ -11,6 +11,7 @@ var (
 	once       sync.Once
 	handlePool *pool
 	routerPool *pool
+	certPool   *pool
 	xEnv       vela.Environment
 	typeof     = reflect.TypeOf((*server)(nil)).String()
 )
@@ -29,13 +30,15 @@ func init() {
 	once.Do(func() {
 		handlePool = newPool()
 		routerPool = newPool()
+		certPool = newPool()
 		go func() {
 			tk := time.NewTicker(time.Second)
 			defer tk.Stop()
 
 			for range tk.C {
-				routerPool.sync(compileRouter)
-				handlePool.sync(compileHandle)
+				routerPool.sync("router", compileRouter)
+				handlePool.sync("handle", compileHandle)
+				certPool.sync("cert", compileCertificate)
 			}
 		}()
 	})
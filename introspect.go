@@ -0,0 +1,272 @@
+package fasthttp
+
+import (
+	"encoding/json"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// routeInfo 路由列表 lua和控制台使用
+type routeInfo struct {
+	Vhost   string   `json:"vhost"`
+	Method  string   `json:"method"`
+	Path    string   `json:"path"`
+	Handles []string `json:"handles"`
+	Count   uint64   `json:"count"`
+}
+
+func (r *vRouter) routeInfos(vhost string) []routeInfo {
+	routes := r.Routes()
+	infos := make([]routeInfo, 0, len(routes))
+	for _, rt := range routes {
+		infos = append(infos, routeInfo{
+			Vhost:   vhost,
+			Method:  rt.method,
+			Path:    rt.path,
+			Handles: rt.Handles(),
+			Count:   rt.Count(),
+		})
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool { return infos[i].Path < infos[j].Path })
+	return infos
+}
+
+// vhostNames 按名称排序的路由
+func (fss *server) vhostNames() ([]string, map[string]*vRouter) {
+	routers := fss.routers()
+	names := make([]string, 0, len(routers))
+	for name := range routers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, routers
+}
+
+func (fss *server) routeInfos() []routeInfo {
+	names, routers := fss.vhostNames()
+
+	var infos []routeInfo
+	for _, name := range names {
+		infos = append(infos, routers[name].routeInfos(name)...)
+	}
+	return infos
+}
+
+func routeInfoTable(L *lua.LState, infos []routeInfo) *lua.LTable {
+	tab := L.CreateTable(len(infos), 0)
+	for _, info := range infos {
+		handles := L.CreateTable(len(info.Handles), 0)
+		for _, name := range info.Handles {
+			handles.Append(lua.S2L(name))
+		}
+
+		item := L.CreateTable(0, 5)
+		item.RawSetString("vhost", lua.S2L(info.Vhost))
+		item.RawSetString("method", lua.S2L(info.Method))
+		item.RawSetString("path", lua.S2L(info.Path))
+		item.RawSetString("handles", handles)
+		item.RawSetString("count", lua.LNumber(info.Count))
+		tab.Append(item)
+	}
+	return tab
+}
+
+// routesL r.routes() 当前路由注册的所有路由
+func (r *vRouter) routesL(L *lua.LState) int {
+	L.Push(routeInfoTable(L, r.routeInfos(r.vhost)))
+	return 1
+}
+
+// routesL http.routes() vhost 路由文件和默认路由的所有路由
+func (fss *server) routesL(L *lua.LState) int {
+	L.Push(routeInfoTable(L, fss.routeInfos()))
+	return 1
+}
+
+type configDump struct {
+	Name      string              `json:"name"`
+	Bind      []string            `json:"bind"`
+	Cert      string              `json:"cert,omitempty"`
+	Key       string              `json:"key,omitempty"`
+	Router    string              `json:"router"`
+	Handler   string              `json:"handler"`
+	Keepalive string              `json:"keepalive"`
+	Reuseport string              `json:"reuseport"`
+	HTTP2     string              `json:"http2"`
+	H2C       string              `json:"h2c"`
+	Daemon    string              `json:"daemon"`
+	Region    string              `json:"region"`
+	Drain     string              `json:"drain_timeout"`
+	Variables map[string]string   `json:"variables"`
+	Default   []string            `json:"default"`
+	Output    string              `json:"output"`
+	Trace     string              `json:"trace"`
+	Phases    map[string][]string `json:"phases,omitempty"`
+
+	ProxyProtocol    string   `json:"proxy_protocol"`
+	ProxyTrusted     []string `json:"proxy_trusted"`
+	Allow            []string `json:"allow"`
+	Deny             []string `json:"deny"`
+	ACLLog           string   `json:"acl_log"`
+	OnConnect        bool     `json:"on_connect"`
+	OnClose          bool     `json:"on_close"`
+	Status           string   `json:"status"`
+	StatusAllow      []string `json:"status_allow"`
+	RequestIDHeader  string   `json:"request_id_header"`
+	RequestIDTrusted []string `json:"request_id_trusted"`
+
+	ReadTimeout        int    `json:"read_timeout"`
+	WriteTimeout       int    `json:"write_timeout"`
+	IdleTimeout        int    `json:"idle_timeout"`
+	MaxRequestBodySize int    `json:"max_request_body_size"`
+	Concurrency        int    `json:"concurrency"`
+	MaxConnsPerIP      int    `json:"max_conns_per_ip"`
+	MaxRequestsPerConn int    `json:"max_requests_per_conn"`
+	ReadBufferSize     int    `json:"read_buffer_size"`
+	WriteBufferSize    int    `json:"write_buffer_size"`
+	NoNormalizing      string `json:"disable_header_normalizing"`
+	ReduceMemory       string `json:"reduce_memory_usage"`
+	ServerName         string `json:"server_name"`
+
+	Vhosts []vhostDump `json:"vhosts"`
+}
+
+type vhostDump struct {
+	Name        string              `json:"name"`
+	Method      string              `json:"method,omitempty"`
+	Handler     string              `json:"handler,omitempty"`
+	Cert        string              `json:"cert,omitempty"`
+	Region      string              `json:"region,omitempty"`
+	Access      string              `json:"access_log,omitempty"`
+	NotFound    []string            `json:"not_found,omitempty"`
+	Rewrite     []string            `json:"rewrite,omitempty"`
+	Phases      map[string][]string `json:"phases,omitempty"`
+	Interceptor bool                `json:"interceptor,omitempty"`
+	Variables   map[string]string   `json:"variables,omitempty"`
+	Output      string              `json:"output,omitempty"`
+	Routes      []routeInfo         `json:"routes"`
+}
+
+func cidrStrings(list []*net.IPNet) []string {
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		out = append(out, item.String())
+	}
+	return out
+}
+
+func writerName(w lua.Writer) string {
+	if w == nil {
+		return ""
+	}
+	return w.Name()
+}
+
+// dump 当前生效的完整配置 审计使用
+func (fss *server) dump() *configDump {
+	cfg := fss.cfg
+	d := &configDump{
+		Name:      cfg.name,
+		Cert:      cfg.cert,
+		Key:       cfg.key,
+		Router:    cfg.router,
+		Handler:   cfg.handler,
+		Keepalive: cfg.keepalive,
+		Reuseport: cfg.reuseport,
+		HTTP2:     cfg.http2,
+		H2C:       cfg.h2c,
+		Daemon:    cfg.daemon,
+		Region:    cfg.region,
+		Drain:     fss.drainTimeout().String(),
+		Variables: cfg.variables,
+		Default:   cfg.notFound.Names(),
+		Output:    writerName(cfg.output),
+		Trace:     writerName(cfg.trace),
+		Phases:    cfg.phase.dump(),
+
+		ProxyProtocol:    cfg.proxy,
+		ProxyTrusted:     cidrStrings(cfg.trusted),
+		ACLLog:           cfg.aclLog,
+		OnConnect:        cfg.onConnect.Load() != nil,
+		OnClose:          cfg.onClose.Load() != nil,
+		Status:           cfg.status,
+		RequestIDHeader:  cfg.requestIDName,
+		RequestIDTrusted: cidrStrings(cfg.requestIDTrusted),
+
+		ReadTimeout:        cfg.readTimeout,
+		WriteTimeout:       cfg.writeTimeout,
+		IdleTimeout:        cfg.idleTimeout,
+		MaxRequestBodySize: cfg.maxRequestBodySize(),
+		Concurrency:        cfg.concurrency,
+		MaxConnsPerIP:      cfg.maxConnsPerIP,
+		MaxRequestsPerConn: cfg.maxReqPerConn,
+		ReadBufferSize:     cfg.readBuffer,
+		WriteBufferSize:    cfg.writeBuffer,
+		NoNormalizing:      cfg.noNormalizing,
+		ReduceMemory:       cfg.reduceMemory,
+		ServerName:         cfg.serverName,
+	}
+
+	if d.RequestIDHeader == "" {
+		d.RequestIDHeader = defaultRequestIDHeader
+	}
+
+	for _, bind := range cfg.bind {
+		d.Bind = append(d.Bind, bind.String())
+	}
+
+	d.Allow, d.Deny = cfg.acl.Rules()
+	d.StatusAllow, _ = cfg.statusACL.Rules()
+
+	names, routers := fss.vhostNames()
+	for _, name := range names {
+		r := routers[name]
+		d.Vhosts = append(d.Vhosts, vhostDump{
+			Name:        name,
+			Method:      r.method.String(),
+			Handler:     r.handler,
+			Cert:        r.cert,
+			Region:      r.region,
+			Access:      r.accessOff,
+			NotFound:    r.notFound.Names(),
+			Rewrite:     r.rewriteRules(),
+			Phases:      r.phase.dump(),
+			Interceptor: r.interceptor != nil,
+			Variables:   r.variables,
+			Output:      writerName(r.output),
+			Routes:      r.routeInfos(name),
+		})
+	}
+	return d
+}
+
+// configL http.config() 返回json格式的完整配置
+func (fss *server) configL(L *lua.LState) int {
+	chunk, err := json.MarshalIndent(fss.dump(), "", "  ")
+	if err != nil {
+		L.RaiseError("%s web config dump error %v", fss.Name(), err)
+		return 0
+	}
+
+	L.Push(lua.B2L(chunk))
+	return 1
+}
+
+// showRoutes 控制台输出所有vhost和路由
+func (fss *server) showRoutes(out lua.Console) {
+	names, routers := fss.vhostNames()
+	for _, name := range names {
+		r := routers[name]
+		out.Printf("vhost %s requests:%d", name, atomic.LoadUint64(&r.count))
+		for _, info := range r.routeInfos(name) {
+			out.Printf("    %-7s %s [%s] hits:%d", info.Method, info.Path, strings.Join(info.Handles, ","), info.Count)
+		}
+		if r.notFound != nil {
+			out.Printf("    %-7s [%s]", "DEFAULT", r.notFound.String())
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package fasthttp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/vela-ssoc/vela-kit/lua"
+)
+
+func TestConfigDump(t *testing.T) {
+	useTestEnv(t)
+
+	cfg := &config{name: "t", acl: newACL(), statusACL: newACL()}
+	cfg.phase[phaseAccess] = newHandleChains(1)
+	cfg.phase[phaseAccess].Store("auth", VHSTRING, 0)
+
+	fss := &server{cfg: cfg, vhost: newPool()}
+	r := &vRouter{interceptor: &lua.LFunction{}, variables: map[string]string{"app": "api"}}
+	r.phase[phaseLog] = newHandleChains(1)
+	r.phase[phaseLog].Store("audit", VHSTRING, 0)
+	if err := fss.addVhost("a.com", r); err != nil {
+		t.Fatal(err)
+	}
+
+	d := fss.dump()
+	if want := map[string][]string{"access": {"handle auth"}}; !reflect.DeepEqual(d.Phases, want) {
+		t.Errorf("server phases got %v want %v", d.Phases, want)
+	}
+
+	if len(d.Vhosts) != 1 {
+		t.Fatalf("vhosts got %d want 1", len(d.Vhosts))
+	}
+
+	v := d.Vhosts[0]
+	if want := map[string][]string{"log": {"handle audit"}}; !reflect.DeepEqual(v.Phases, want) {
+		t.Errorf("vhost phases got %v want %v", v.Phases, want)
+	}
+
+	if !v.Interceptor || v.Variables["app"] != "api" {
+		t.Errorf("vhost dump got %+v", v)
+	}
+}
+
+func TestRoutersNamespace(t *testing.T) {
+	useTestEnv(t)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "api.lua")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stat, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//mtime和文件一致 后台sync不会重新编译
+	fr := &vRouter{name: file, mtime: stat.ModTime().Unix()}
+	routerPool.insert(file, fr)
+	defer routerPool.remove(file)
+
+	fss := &server{cfg: &config{router: dir}, vhost: newPool()}
+	vr := &vRouter{}
+	if err = fss.addVhost("api", vr); err != nil {
+		t.Fatal(err)
+	}
+
+	routers := fss.routers()
+	if routers["api"] != vr {
+		t.Errorf("vhost api got %v", routers["api"])
+	}
+
+	if routers["file:api"] != fr {
+		t.Errorf("router file api got %v", routers["file:api"])
+	}
+}
@@ -0,0 +1,281 @@
+package fasthttp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-kit/auxlib"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	listenInit  = "init"
+	listenRun   = "running"
+	listenClose = "closed"
+	listenPanic = "panic"
+)
+
+// listener 每个bind地址对应一个监听 共用同一个server.Handler
+type listener struct {
+	fss  *server
+	bind auxlib.URL
+
+	ln  net.Listener
+	fs  *fasthttp.Server
+	h3  *http3.Server
+	udp net.PacketConn
+
+	//quic Alt-Svc
+	altSvc string
+
+	mu    sync.Mutex
+	state string
+	err   error
+}
+
+func newListener(fss *server, bind auxlib.URL) *listener {
+	return &listener{fss: fss, bind: bind, state: listenInit}
+}
+
+func secureScheme(scheme string) bool {
+	switch scheme {
+	case "tls", "https", "quic":
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *listener) secure() bool {
+	return secureScheme(l.bind.Scheme())
+}
+
+func (l *listener) quic() bool {
+	return l.bind.Scheme() == "quic"
+}
+
+// option 优先读取bind上的参数 没有就用web{}的全局配置
+func (l *listener) option(key string) string {
+	if v := l.bind.Value(key); v != "" {
+		return v
+	}
+
+	switch key {
+	case "keepalive":
+		return l.fss.cfg.keepalive
+	case "reuseport":
+		return l.fss.cfg.reuseport
+	case "http2":
+		return l.fss.cfg.http2
+	case "h2c":
+		return l.fss.cfg.h2c
+	case "proxy_protocol":
+		return l.fss.cfg.proxy
+	default:
+		return ""
+	}
+}
+
+func (l *listener) timeout(key string) time.Duration {
+	if v := l.bind.Int(key); v > 0 {
+		return time.Duration(v) * time.Second
+	}
+
+	var v int
+	switch key {
+	case "read_timeout":
+		v = l.fss.cfg.readTimeout
+	case "write_timeout":
+		v = l.fss.cfg.writeTimeout
+	case "idle_timeout":
+		v = l.fss.cfg.idleTimeout
+	}
+	return time.Duration(v) * time.Second
+}
+
+func (l *listener) h2() bool {
+	if l.option("h2c") == "on" {
+		return true
+	}
+
+	return l.secure() && l.option("http2") == "on"
+}
+
+func (l *listener) setState(state string, err error) {
+	l.mu.Lock()
+	l.state = state
+	l.err = err
+	l.mu.Unlock()
+}
+
+func (l *listener) State() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state, l.err
+}
+
+func (l *listener) Listen() (net.Listener, error) {
+	var network, address string
+
+	network = l.bind.Scheme()
+	switch network {
+	case "unix", "pipe":
+		address = l.bind.Path()
+	case "tls", "https", "quic":
+		network = "tcp"
+		address = l.bind.Host()
+	default:
+		address = l.bind.Host()
+
+	}
+
+	//相同bind的监听在重启时直接接管 不会断开端口
+	ln, err := inherited.listen(network, address, l.option("reuseport") == "on")
+	if err != nil {
+		return nil, err
+	}
+
+	//PROXY协议头在tls握手之前
+	if l.option("proxy_protocol") == "on" {
+		if len(l.fss.cfg.trusted) == 0 {
+			xEnv.Errorf("%s web %s proxy_protocol on without proxy_trusted , PROXY header ignored", l.fss.Name(), l.bind.String())
+		}
+		ln = newProxyListener(ln, l.fss.cfg.trusted, l.fss.permit)
+	} else {
+		ln = newACLListener(ln, l.fss)
+	}
+
+	ln = newTrackListener(ln, l.fss, l.option("keepalive") == "on")
+
+	if l.secure() {
+		ln = tls.NewListener(ln, l.fss.tlsConfig(l.option("http2") == "on"))
+	}
+
+	if l.h2() {
+		return newH2Listener(l, ln), nil
+	}
+
+	return ln, nil
+}
+
+func (l *listener) Handler(ctx *RequestCtx) {
+	l.advertise(ctx)
+	l.fss.Handler(ctx)
+}
+
+func (l *listener) Start() error {
+	ln, err := l.Listen()
+	if err != nil {
+		return err
+	}
+
+	if l.quic() {
+		if e := l.listenQuic(); e != nil {
+			_ = ln.Close()
+			return e
+		}
+	}
+
+	cfg := l.fss.cfg
+	l.fs = &fasthttp.Server{
+		Handler:                       l.Handler,
+		Name:                          cfg.serverHeader(),
+		NoDefaultServerHeader:         cfg.serverHeader() == "",
+		TCPKeepalive:                  l.option("keepalive") == "on",
+		ReadTimeout:                   l.timeout("read_timeout"),
+		WriteTimeout:                  l.timeout("write_timeout"),
+		IdleTimeout:                   l.timeout("idle_timeout"),
+		MaxRequestBodySize:            cfg.maxRequestBodySize(),
+		Concurrency:                   cfg.concurrency,
+		MaxConnsPerIP:                 cfg.maxConnsPerIP,
+		MaxRequestsPerConn:            cfg.maxReqPerConn,
+		ReadBufferSize:                cfg.readBuffer,
+		WriteBufferSize:               cfg.writeBuffer,
+		DisableHeaderNamesNormalizing: cfg.noNormalizing == "on",
+		ReduceMemoryUsage:             cfg.reduceMemory == "on",
+		ConnState:                     l.fss.conns.ConnState,
+		Logger:                        adaptorLogger{},
+		CloseOnShutdown:               true,
+	}
+	l.ln = ln
+
+	rl := newReadyListener(ln)
+	done := make(chan error, 1)
+	go l.serve(rl, done)
+
+	if err = l.wait(rl, done); err != nil {
+		l.closeQuic()
+		l.setState(listenPanic, err)
+		return err
+	}
+
+	l.setState(listenRun, nil)
+	return nil
+}
+
+func (l *listener) fail(err error) {
+	if l.fss.IsClose() {
+		return
+	}
+
+	l.setState(listenPanic, err)
+	l.fss.fail(fmt.Errorf("%s %v", l.bind.String(), err))
+}
+
+// shutdown 停止接收新连接 等待请求处理完成
+func (l *listener) shutdown(ctx context.Context) {
+	if l.fs == nil {
+		return
+	}
+
+	h2, _ := l.ln.(*h2Listener)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if e := l.fs.ShutdownWithContext(ctx); e != nil {
+			xEnv.Errorf("%s web %s shutdown %v", l.fss.Name(), l.bind.String(), e)
+		}
+	}()
+
+	if h2 != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h2.drain(ctx)
+		}()
+	}
+
+	if l.h3 != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if e := l.h3.Shutdown(ctx); e != nil {
+				xEnv.Errorf("%s web %s quic shutdown %v", l.fss.Name(), l.bind.String(), e)
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// closeActive 强制关闭fasthttp之外的连接
+func (l *listener) closeActive() int {
+	h2, ok := l.ln.(*h2Listener)
+	if !ok {
+		return 0
+	}
+
+	return h2.closeActive()
+}
+
+func (l *listener) Close() error {
+	l.closeQuic()
+	l.setState(listenClose, nil)
+	return nil
+}
@@ -32,6 +32,8 @@ func WithEnv(env vela.Environment) {
 	kv.Set("redirect", lua.NewFunction(newLuaRedirectL))
 	kv.Set("H", lua.NewFunction(newLuaHeader))
 	kv.Set("vhost", lua.NewFunction(newLuaHost))
+	kv.Set("metrics", lua.NewFunction(newLuaMetricsL))
+	kv.Set("proxy", lua.NewFunction(newLuaProxyL))
 
 	env.Global("web",
 		lua.NewExport("vela.web.export",
@@ -0,0 +1,95 @@
+package fasthttp
+
+import (
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-kit/auxlib"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"strings"
+)
+
+// methodSet handle和router允许的请求方法 为空时不限制
+type methodSet []string
+
+func validMethod(m string) bool {
+	switch m {
+	case fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodPost, fasthttp.MethodPut, fasthttp.MethodPatch,
+		fasthttp.MethodDelete, fasthttp.MethodConnect, fasthttp.MethodOptions, fasthttp.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkMethodSet 单个方法 逗号分隔的字符串或者列表 ANY表示不限制
+func checkMethodSet(L *lua.LState, val lua.LValue) methodSet {
+	var items []string
+	switch val.Type() {
+	case lua.LTNil:
+		return nil
+	case lua.LTTable:
+		items = auxlib.LTab2SS(val.(*lua.LTable))
+	default:
+		items = strings.Split(val.String(), ",")
+	}
+
+	var ms methodSet
+	for _, item := range items {
+		m := strings.ToUpper(strings.TrimSpace(item))
+		switch {
+		case m == "":
+			continue
+		case m == "ANY":
+			return nil
+		case !validMethod(m):
+			L.RaiseError("invalid method %s", item)
+			return nil
+		}
+
+		if !ms.has(m) {
+			ms = append(ms, m)
+		}
+	}
+
+	//允许GET时同时允许HEAD
+	if ms.has(fasthttp.MethodGet) && !ms.has(fasthttp.MethodHead) {
+		ms = append(ms, fasthttp.MethodHead)
+	}
+	return ms
+}
+
+func (ms methodSet) has(m string) bool {
+	for _, item := range ms {
+		if item == m {
+			return true
+		}
+	}
+	return false
+}
+
+func (ms methodSet) match(ctx *RequestCtx) bool {
+	if len(ms) == 0 {
+		return true
+	}
+	return ms.has(string(ctx.Method()))
+}
+
+// Allow 405时返回的Allow头
+func (ms methodSet) Allow() string {
+	return strings.Join(ms, ", ")
+}
+
+func (ms methodSet) String() string {
+	return strings.Join(ms, ",")
+}
+
+// notAllowed 请求方法不在router的method中 返回405
+func (r *vRouter) notAllowed(ctx *RequestCtx) bool {
+	if r.method.match(ctx) {
+		return false
+	}
+
+	//Error会清空响应头 Allow在后面设置
+	ctx.Error(fasthttp.StatusMessage(fasthttp.StatusMethodNotAllowed), fasthttp.StatusMethodNotAllowed)
+	ctx.Response.Header.Set(fasthttp.HeaderAllow, r.method.Allow())
+	return true
+}
@@ -0,0 +1,356 @@
+package fasthttp
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	sizeBuckets    = []float64{128, 1024, 8192, 65536, 524288, 4194304, 33554432}
+
+	//newLuaThread 创建的协程
+	luaThreadClone     uint64
+	luaThreadCoroutine uint64
+
+	compileCounter = &compileStats{items: make(map[compileStatsKey]uint64)}
+
+	//所有运行中的server 按照名称导出
+	metricsServers = &metricsRegistry{items: make(map[string]*server)}
+)
+
+type compileStatsKey struct {
+	pool   string
+	result string
+}
+
+// compileStats router handle cert 编译成功和失败的次数
+type compileStats struct {
+	mu    sync.Mutex
+	items map[compileStatsKey]uint64
+}
+
+func (cs *compileStats) add(pool string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	cs.mu.Lock()
+	cs.items[compileStatsKey{pool: pool, result: result}]++
+	cs.mu.Unlock()
+}
+
+type metricsRegistry struct {
+	mu    sync.Mutex
+	items map[string]*server
+}
+
+func (mr *metricsRegistry) register(fss *server) {
+	mr.mu.Lock()
+	mr.items[fss.Name()] = fss
+	mr.mu.Unlock()
+}
+
+func (mr *metricsRegistry) unregister(fss *server) {
+	mr.mu.Lock()
+	if mr.items[fss.Name()] == fss {
+		delete(mr.items, fss.Name())
+	}
+	mr.mu.Unlock()
+}
+
+func (mr *metricsRegistry) list() []*server {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	list := make([]*server, 0, len(mr.items))
+	for _, fss := range mr.items {
+		list = append(list, fss)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// routeKey 标签只使用路由模式 不使用原始uri 防止标签数量失控
+type routeKey struct {
+	vhost string
+	route string
+}
+
+type requestKey struct {
+	routeKey
+	method string
+	code   int
+}
+
+type serverMetrics struct {
+	mu       sync.Mutex
+	requests map[requestKey]uint64
+	latency  map[routeKey]*histogram
+	size     map[routeKey]*histogram
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests: make(map[requestKey]uint64),
+		latency:  make(map[routeKey]*histogram),
+		size:     make(map[routeKey]*histogram),
+	}
+}
+
+func metricsMethod(method string) string {
+	switch method {
+	case fasthttp.MethodGet, fasthttp.MethodHead, fasthttp.MethodPost, fasthttp.MethodPut, fasthttp.MethodPatch,
+		fasthttp.MethodDelete, fasthttp.MethodConnect, fasthttp.MethodOptions, fasthttp.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
+
+// vhostLabel vhost名称 路由文件名 或者默认路由
+func vhostLabel(r *vRouter) string {
+	switch {
+	case r == nil:
+		return "default"
+	case r.vhost != "":
+		return r.vhost
+	case r.name != "":
+		return strings.TrimSuffix(filepath.Base(r.name), ".lua")
+	default:
+		return "default"
+	}
+}
+
+func (sm *serverMetrics) observe(r *vRouter, ctx *RequestCtx, start time.Time) {
+	key := routeKey{vhost: vhostLabel(r), route: "not_found"}
+	if rt := routeOf(ctx); rt != nil {
+		key.route = rt.path
+	}
+
+	rk := requestKey{routeKey: key, method: metricsMethod(string(ctx.Method())), code: ctx.Response.StatusCode()}
+	//流式响应读取Body会把流读完 只使用Content-Length 长度未知时不统计
+	size := -1.0
+	if !ctx.Response.IsBodyStream() {
+		size = float64(len(ctx.Response.Body()))
+	} else if n := ctx.Response.Header.ContentLength(); n >= 0 {
+		size = float64(n)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.requests[rk]++
+
+	lh, ok := sm.latency[key]
+	if !ok {
+		lh = newHistogram(latencyBuckets)
+		sm.latency[key] = lh
+	}
+	lh.observe(time.Since(start).Seconds())
+
+	sh, ok := sm.size[key]
+	if !ok {
+		sh = newHistogram(sizeBuckets)
+		sm.size[key] = sh
+	}
+
+	if size >= 0 {
+		sh.observe(size)
+	}
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (mw *metricsWriter) head(name, typ, help string) {
+	fmt.Fprintf(&mw.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (mw *metricsWriter) sample(name string, labels []string, value string) {
+	mw.buf.WriteString(name)
+	if len(labels) > 0 {
+		mw.buf.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				mw.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&mw.buf, `%s="%s"`, labels[i], escapeLabel(labels[i+1]))
+		}
+		mw.buf.WriteByte('}')
+	}
+	mw.buf.WriteByte(' ')
+	mw.buf.WriteString(value)
+	mw.buf.WriteByte('\n')
+}
+
+func (mw *metricsWriter) histogram(name string, labels []string, h *histogram) {
+	for i, le := range h.buckets {
+		mw.sample(name+"_bucket", append(labels, "le", formatFloat(le)), strconv.FormatUint(h.counts[i], 10))
+	}
+	mw.sample(name+"_bucket", append(labels, "le", "+Inf"), strconv.FormatUint(h.count, 10))
+	mw.sample(name+"_sum", labels, formatFloat(h.sum))
+	mw.sample(name+"_count", labels, strconv.FormatUint(h.count, 10))
+}
+
+func sortedRouteKeys(m map[routeKey]*histogram) []routeKey {
+	keys := make([]routeKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].vhost != keys[j].vhost {
+			return keys[i].vhost < keys[j].vhost
+		}
+		return keys[i].route < keys[j].route
+	})
+	return keys
+}
+
+func (sm *serverMetrics) writeRequests(mw *metricsWriter, name string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(sm.requests))
+	for k := range sm.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.vhost != b.vhost {
+			return a.vhost < b.vhost
+		}
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+
+	for _, k := range keys {
+		mw.sample("vela_http_requests_total",
+			[]string{"server", name, "vhost", k.vhost, "route", k.route, "method", k.method, "code", strconv.Itoa(k.code)},
+			strconv.FormatUint(sm.requests[k], 10))
+	}
+}
+
+func (sm *serverMetrics) writeHistograms(mw *metricsWriter, metric string, name string, m map[routeKey]*histogram) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for _, k := range sortedRouteKeys(m) {
+		mw.histogram(metric, []string{"server", name, "vhost", k.vhost, "route", k.route}, m[k])
+	}
+}
+
+// writeServerMetrics 每个指标只输出一次 所有server的样本连续输出 否则prometheus解析失败
+func writeServerMetrics(mw *metricsWriter, list []*server) {
+	mw.head("vela_http_inflight_requests", "gauge", "Requests currently being served.")
+	for _, fss := range list {
+		mw.sample("vela_http_inflight_requests", []string{"server", fss.Name()}, strconv.FormatInt(atomic.LoadInt64(&fss.inflight), 10))
+	}
+
+	mw.head("vela_http_connections", "gauge", "Open client connections.")
+	for _, fss := range list {
+		mw.sample("vela_http_connections", []string{"server", fss.Name()}, strconv.Itoa(fss.activeConns()))
+	}
+
+	mw.head("vela_http_rejected_connections_total", "counter", "Connections rejected by the allow/deny lists.")
+	for _, fss := range list {
+		mw.sample("vela_http_rejected_connections_total", []string{"server", fss.Name()}, strconv.FormatUint(fss.cfg.acl.Rejected(), 10))
+	}
+
+	mw.head("vela_http_requests_total", "counter", "Requests served by server, vhost and route pattern.")
+	for _, fss := range list {
+		fss.metrics.writeRequests(mw, fss.Name())
+	}
+
+	mw.head("vela_http_request_duration_seconds", "histogram", "Request latency by server, vhost and route pattern.")
+	for _, fss := range list {
+		fss.metrics.writeHistograms(mw, "vela_http_request_duration_seconds", fss.Name(), fss.metrics.latency)
+	}
+
+	mw.head("vela_http_response_size_bytes", "histogram", "Response body size by server, vhost and route pattern.")
+	for _, fss := range list {
+		fss.metrics.writeHistograms(mw, "vela_http_response_size_bytes", fss.Name(), fss.metrics.size)
+	}
+}
+
+func writeGlobalMetrics(mw *metricsWriter) {
+	mw.head("vela_http_lua_threads_total", "counter", "Lua threads created for requests.")
+	mw.sample("vela_http_lua_threads_total", []string{"kind", "clone"}, strconv.FormatUint(atomic.LoadUint64(&luaThreadClone), 10))
+	mw.sample("vela_http_lua_threads_total", []string{"kind", "coroutine"}, strconv.FormatUint(atomic.LoadUint64(&luaThreadCoroutine), 10))
+
+	compileCounter.mu.Lock()
+	keys := make([]compileStatsKey, 0, len(compileCounter.items))
+	for k := range compileCounter.items {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].pool != keys[j].pool {
+			return keys[i].pool < keys[j].pool
+		}
+		return keys[i].result < keys[j].result
+	})
+
+	mw.head("vela_http_compile_total", "counter", "Router, handle and certificate compiles by result.")
+	for _, k := range keys {
+		mw.sample("vela_http_compile_total", []string{"pool", k.pool, "result", k.result}, strconv.FormatUint(compileCounter.items[k], 10))
+	}
+	compileCounter.mu.Unlock()
+}
+
+// metricsHandler 导出所有server的指标 可以挂到任意路由上
+func metricsHandler(ctx *RequestCtx) {
+	mw := &metricsWriter{}
+	writeServerMetrics(mw, metricsServers.list())
+	writeGlobalMetrics(mw)
+
+	ctx.SetContentType("text/plain; version=0.0.4; charset=utf-8")
+	ctx.SetBody(mw.buf.Bytes())
+}
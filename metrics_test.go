@@ -0,0 +1,69 @@
+package fasthttp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestServerMetricsGrouped(t *testing.T) {
+	useTestEnv(t)
+
+	var list []*server
+	for _, name := range []string{"a", "b"} {
+		fss := &server{cfg: &config{name: name, acl: newACL()}, conns: newConnTracker(), metrics: newServerMetrics()}
+		key := routeKey{vhost: "default", route: "/"}
+		fss.metrics.requests[requestKey{routeKey: key, method: "GET", code: 200}] = 1
+		fss.metrics.latency[key] = newHistogram(latencyBuckets)
+		fss.metrics.size[key] = newHistogram(sizeBuckets)
+		list = append(list, fss)
+	}
+
+	mw := &metricsWriter{}
+	writeServerMetrics(mw, list)
+
+	//同一个指标的样本必须连续 不能被其他指标隔开
+	family := func(line string) string {
+		if strings.HasPrefix(line, "# ") {
+			return strings.Fields(line)[2]
+		}
+
+		name := line[:strings.IndexAny(line, "{ ")]
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if strings.HasPrefix(name, "vela_http_request_duration_seconds") || strings.HasPrefix(name, "vela_http_response_size_bytes") {
+				name = strings.TrimSuffix(name, suffix)
+			}
+		}
+		return name
+	}
+
+	done := make(map[string]bool)
+	servers := make(map[string]map[string]bool)
+	last := ""
+	for _, line := range strings.Split(strings.TrimSpace(mw.buf.String()), "\n") {
+		name := family(line)
+		if name != last {
+			if done[name] {
+				t.Fatalf("%s samples are not contiguous\n%s", name, mw.buf.String())
+			}
+			done[last] = true
+			last = name
+		}
+
+		if i := strings.Index(line, `server="`); i >= 0 {
+			if servers[name] == nil {
+				servers[name] = make(map[string]bool)
+			}
+			servers[name][line[i+8:i+9]] = true
+		}
+	}
+
+	for name, got := range servers {
+		if !got["a"] || !got["b"] {
+			t.Errorf("%s servers got %v", name, got)
+		}
+	}
+
+	if len(servers) != 6 {
+		t.Errorf("families got %d want 6", len(servers))
+	}
+}
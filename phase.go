@@ -0,0 +1,133 @@
+package fasthttp
+
+import (
+	"github.com/vela-ssoc/vela-kit/lua"
+)
+
+type phase int
+
+// 请求阶段 执行顺序:rewrite access 路由处理 header_filter body_filter log
+const (
+	phaseRewrite phase = iota
+	phaseAccess
+	phaseHeaderFilter
+	phaseBodyFilter
+	phaseLog
+	phaseMax
+)
+
+var phaseNames = [phaseMax]string{"rewrite", "access", "header_filter", "body_filter", "log"}
+
+func (p phase) String() string {
+	return phaseNames[p]
+}
+
+func phaseOf(name string) (phase, bool) {
+	for i, item := range phaseNames {
+		if item == name {
+			return phase(i), true
+		}
+	}
+	return phaseMax, false
+}
+
+// phases 每个阶段的handle链 server和router各有一份
+type phases [phaseMax]*HandleChains
+
+// set 配置中的阶段 不是阶段名称返回false
+func (ph *phases) set(key string, val lua.LValue) bool {
+	p, ok := phaseOf(key)
+	if !ok {
+		return false
+	}
+
+	hc := newHandleChainsL(val)
+	hc.phase = true
+	ph[p] = hc
+	return true
+}
+
+// checkPhaseChains 参数都是handle 从第一个参数开始
+func checkPhaseChains(L *lua.LState) *HandleChains {
+	n := L.GetTop()
+	hc := newHandleChains(n)
+	for i := 1; i <= n; i++ {
+		hc.StoreL(L.Get(i), i-1)
+	}
+	hc.phase = true
+	return hc
+}
+
+func (ph *phases) indexFn(L *lua.LState, p phase) *lua.LFunction {
+	return L.NewFunction(func(co *lua.LState) int {
+		ph[p] = checkPhaseChains(co)
+		return 0
+	})
+}
+
+// dump 每个阶段的handle链 没有配置的阶段不输出
+func (ph *phases) dump() map[string][]string {
+	var out map[string][]string
+	for i, hc := range ph {
+		if hc == nil {
+			continue
+		}
+
+		if out == nil {
+			out = make(map[string][]string)
+		}
+		out[phase(i).String()] = hc.Names()
+	}
+	return out
+}
+
+// runPhase 先执行server的阶段再执行router的阶段 ctx.exit ctx.eof或者命中eof的handle结束请求时返回true
+func (fss *server) runPhase(p phase, r *vRouter, ctx *RequestCtx) bool {
+	if hc := fss.cfg.phase[p]; hc != nil && hc.run(ctx, fss.cfg.handler) {
+		return true
+	}
+
+	if r == nil {
+		return false
+	}
+
+	if hc := r.phase[p]; hc != nil && hc.run(ctx, r.handler) {
+		return true
+	}
+	return false
+}
+
+// phaseRouter 没有命中vhost时使用默认路由的阶段
+func (fss *server) phaseRouter(r *vRouter) *vRouter {
+	if r != nil {
+		return r
+	}
+	return fss.cfg.r
+}
+
+// serve 按照阶段顺序处理请求 rewrite规则在rewrite阶段之前执行 没有命中vhost时交给默认路由
+func (fss *server) serve(r *vRouter, ctx *RequestCtx) {
+	pr := fss.phaseRouter(r)
+	if pr.rewriteURI(ctx) || fss.runPhase(phaseRewrite, pr, ctx) || fss.runPhase(phaseAccess, pr, ctx) {
+		goto filter
+	}
+
+	if r == nil {
+		fss.notFound(ctx)
+	} else {
+		r.do(ctx)
+	}
+
+filter:
+	//路由中的ctx.exit只结束路由处理 过滤阶段继续执行
+	ctx.SetUserValue(eof_uv_key, false)
+	if !fss.runPhase(phaseHeaderFilter, pr, ctx) {
+		fss.runPhase(phaseBodyFilter, pr, ctx)
+	}
+}
+
+// logPhase 访问日志之后执行 前面的阶段结束请求时也会执行
+func (fss *server) logPhase(r *vRouter, ctx *RequestCtx) {
+	ctx.SetUserValue(eof_uv_key, false)
+	fss.runPhase(phaseLog, fss.phaseRouter(r), ctx)
+}
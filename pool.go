@@ -96,6 +96,30 @@ func (p *pool) GetIdx(idx int) *poolItem {
 	return v
 }
 
+func (p *pool) Size() int {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	return p.Len()
+}
+
+func (p *pool) Range(fn func(key string, val PoolItemIFace)) {
+	p.m.RLock()
+	defer p.m.RUnlock()
+
+	for _, item := range p.v {
+		if item.key == "" {
+			continue
+		}
+		fn(item.key, item.val)
+	}
+}
+
+// poolPrefer 模糊匹配同时命中多个时 优先级高的返回true
+type poolPrefer interface {
+	Prefer(PoolItemIFace) bool
+}
+
+// Grep 模糊匹配 实现了poolPrefer时选择优先级最高的 否则返回第一个
 func (p *pool) Grep(key string) *poolItem {
 	p.m.RLock()
 	defer p.m.RUnlock()
@@ -105,14 +129,29 @@ func (p *pool) Grep(key string) *poolItem {
 		return nil
 	}
 
+	var hit *poolItem
 	for i := 0; i < n; i++ {
 		item := p.v[i]
-		if item.val.Match(key) {
-			return item
+		if item.key == "" || !item.val.Match(key) {
+			continue
+		}
+
+		if hit == nil {
+			hit = item
+			continue
+		}
+
+		pf, ok := item.val.(poolPrefer)
+		if !ok {
+			return hit
+		}
+
+		if pf.Prefer(hit.val) {
+			hit = item
 		}
 	}
 
-	return nil
+	return hit
 }
 
 func (p *pool) Get(key string) *poolItem {
@@ -195,6 +234,9 @@ func (p *pool) clear(prefix string) {
 	for i := 0; i < n; i++ {
 		if strings.HasPrefix(p.v[i].key, prefix) {
 			xEnv.Errorf("clear %s ... ", p.v[i].key)
+			if e := p.v[i].val.Close(); e != nil {
+				xEnv.Errorf("pool %s close error %v", p.v[i].key, e)
+			}
 			p.v[i].clear()
 			k++
 		}
@@ -208,9 +250,55 @@ func (p *pool) clear(prefix string) {
 	xEnv.Errorf("%s sync clear succeed", prefix)
 }
 
+// remove 只删除key完全相同的项 clear按照前缀会误删 例如example.com和example.com.cn
+func (p *pool) remove(key string) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	n := p.Len()
+	for i := 0; i < n; i++ {
+		if p.v[i].key != key {
+			continue
+		}
+
+		if e := p.v[i].val.Close(); e != nil {
+			xEnv.Errorf("pool %s close error %v", key, e)
+		}
+		//直接从有序数组中删除 不依赖排序后截断
+		p.v[i].clear()
+		copy(p.v[i:], p.v[i+1:])
+		p.v[n-1] = nil
+		p.v = p.v[:n-1]
+		for j := i; j < n-1; j++ {
+			p.v[j].id = j
+		}
+		return
+	}
+}
+
 type compileFn func(string, ...interface{}) (PoolItemIFace, error)
 
-func (p *pool) sync(compile compileFn) {
+// poolWatcher 除了key之外还依赖其他文件 例如证书的私钥
+type poolWatcher interface {
+	Watch() []string
+}
+
+// latestMTime 多个文件中最新的修改时间 读取失败的文件忽略
+func latestMTime(mtime int64, files ...string) int64 {
+	for _, file := range files {
+		stat, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		if t := stat.ModTime().Unix(); t > mtime {
+			mtime = t
+		}
+	}
+	return mtime
+}
+
+func (p *pool) sync(kind string, compile compileFn) {
 	p.m.Lock()
 	n := p.Len()
 	del := 0
@@ -236,13 +324,20 @@ func (p *pool) sync(compile compileFn) {
 			continue
 		}
 
-		//如果没有修改
-		if stat.ModTime().Unix() == item.Val().MTime() {
+		//如果没有修改 依赖多个文件时取最新的修改时间
+		mtime := stat.ModTime().Unix()
+		if w, ok := item.val.(poolWatcher); ok {
+			mtime = latestMTime(mtime, w.Watch()...)
+		}
+
+		if mtime == item.Val().MTime() {
 			continue
 		}
 
 		//编译
-		if obj, e := compile(item.key, item.val.Option()); e != nil {
+		obj, e := compile(item.key, item.val.Option())
+		recordCompile(kind, item.key, e)
+		if e != nil {
 			xEnv.Errorf("%s compile error %v", item.key, e)
 			continue
 		} else {
@@ -0,0 +1,31 @@
+package fasthttp
+
+import "testing"
+
+func TestPoolRemoveExactKey(t *testing.T) {
+	useTestEnv(t)
+
+	p := newPool()
+	keys := []string{"example.com", "example.com.cn", "*.a.com", "*.a.com.au", "~^api", "~^api2"}
+	for _, key := range keys {
+		p.insert(key, newHandle(key))
+	}
+
+	//按照前缀清理会把后面的vhost一起删掉
+	for _, key := range []string{"example.com", "*.a.com", "~^api"} {
+		p.remove(key)
+		if p.Get(key) != nil {
+			t.Errorf("%s still in pool", key)
+		}
+	}
+
+	for _, key := range []string{"example.com.cn", "*.a.com.au", "~^api2"} {
+		if p.Get(key) == nil {
+			t.Errorf("%s lost after remove", key)
+		}
+	}
+
+	if n := p.Size(); n != 3 {
+		t.Fatalf("size got %d want 3", n)
+	}
+}
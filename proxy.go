@@ -0,0 +1,357 @@
+package fasthttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	proxyV1Prefix = []byte("PROXY ")
+	proxyV2Sig    = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	proxyHeaderLimit = 5 * time.Second
+
+	invalidProxyHeader = errors.New("invalid proxy protocol header")
+)
+
+// proxyListener 解析PROXY v1/v2协议头 只信任来自trusted的连接
+// 协议头在每个连接自己的协程中读取 解析完成后才交给fasthttp 不阻塞accept
+type proxyListener struct {
+	net.Listener
+	trusted []*net.IPNet
+	permit  func(remote, local net.Addr) bool
+
+	conn chan net.Conn
+	done chan struct{}
+	err  error
+	once sync.Once
+}
+
+func newProxyListener(ln net.Listener, trusted []*net.IPNet, permit func(remote, local net.Addr) bool) *proxyListener {
+	pl := &proxyListener{
+		Listener: ln,
+		trusted:  trusted,
+		permit:   permit,
+		conn:     make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+
+	go pl.accept()
+	return pl
+}
+
+// trust 没有配置proxy_trusted时不信任任何来源 防止客户端伪造地址
+func (pl *proxyListener) trust(addr net.Addr) bool {
+	if len(pl.trusted) == 0 {
+		return false
+	}
+
+	x, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, cidr := range pl.trusted {
+		if cidr.Contains(x.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptDelay 临时错误(EMFILE ECONNABORTED等)之后的等待时间 从5ms开始翻倍 最多1s
+func acceptDelay(delay time.Duration) time.Duration {
+	if delay == 0 {
+		return 5 * time.Millisecond
+	}
+
+	if delay *= 2; delay > time.Second {
+		return time.Second
+	}
+	return delay
+}
+
+func (pl *proxyListener) accept() {
+	var delay time.Duration
+	for {
+		c, err := pl.Listener.Accept()
+		if err != nil {
+			//只有监听关闭才退出 其他错误等待后重试
+			if errors.Is(err, net.ErrClosed) {
+				pl.shutdown(err)
+				return
+			}
+
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+
+			delay = acceptDelay(delay)
+			xEnv.Errorf("proxy protocol accept error %v , retry in %s", err, delay)
+			select {
+			case <-time.After(delay):
+			case <-pl.done:
+				return
+			}
+			continue
+		}
+		delay = 0
+
+		if pl.trust(c.RemoteAddr()) {
+			go pl.dispatch(c)
+			continue
+		}
+
+		//不信任的来源 不解析协议头 防止伪造地址
+		if pl.permit(c.RemoteAddr(), c.LocalAddr()) {
+			pl.handoff(c)
+			continue
+		}
+
+		_ = c.Close()
+	}
+}
+
+// dispatch 读取协议头后按照真实客户端地址检查访问控制
+func (pl *proxyListener) dispatch(c net.Conn) {
+	pc := &proxyConn{Conn: c, r: bufio.NewReader(c)}
+	if err := pc.readHeader(); err != nil {
+		_ = c.Close()
+		return
+	}
+
+	if !pl.permit(pc.RemoteAddr(), pc.LocalAddr()) {
+		_ = c.Close()
+		return
+	}
+
+	pl.handoff(pc)
+}
+
+func (pl *proxyListener) handoff(c net.Conn) {
+	select {
+	case pl.conn <- c:
+	case <-pl.done:
+		_ = c.Close()
+	}
+}
+
+func (pl *proxyListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-pl.conn:
+		return c, nil
+	case <-pl.done:
+		return nil, pl.err
+	}
+}
+
+func (pl *proxyListener) shutdown(err error) {
+	pl.once.Do(func() {
+		pl.err = err
+		close(pl.done)
+	})
+}
+
+func (pl *proxyListener) Close() error {
+	err := pl.Listener.Close()
+	pl.shutdown(net.ErrClosed)
+	return err
+}
+
+// proxyConn 协议头已经读取完成的连接 地址为协议头中的地址
+type proxyConn struct {
+	net.Conn
+	r   *bufio.Reader
+	src net.Addr
+	dst net.Addr
+}
+
+// readHeader 连接交给fasthttp之前调用 之前没有设置过读超时 读取完成后恢复为不超时
+func (pc *proxyConn) readHeader() error {
+	_ = pc.Conn.SetReadDeadline(time.Now().Add(proxyHeaderLimit))
+	err := pc.parse()
+	_ = pc.Conn.SetReadDeadline(time.Time{})
+	return err
+}
+
+func (pc *proxyConn) Read(b []byte) (int, error) {
+	return pc.r.Read(b)
+}
+
+func (pc *proxyConn) RemoteAddr() net.Addr {
+	if pc.src != nil {
+		return pc.src
+	}
+	return pc.Conn.RemoteAddr()
+}
+
+func (pc *proxyConn) LocalAddr() net.Addr {
+	if pc.dst != nil {
+		return pc.dst
+	}
+	return pc.Conn.LocalAddr()
+}
+
+// Peer 负载均衡的地址
+func (pc *proxyConn) Peer() net.Addr {
+	return pc.Conn.RemoteAddr()
+}
+
+func (pc *proxyConn) NetConn() net.Conn {
+	return pc.Conn
+}
+
+func (pc *proxyConn) parse() error {
+	head, err := pc.r.Peek(len(proxyV2Sig))
+	switch {
+	case err == nil && bytes.Equal(head, proxyV2Sig):
+		return pc.parseV2()
+	case len(head) >= len(proxyV1Prefix) && bytes.Equal(head[:len(proxyV1Prefix)], proxyV1Prefix):
+		return pc.parseV1()
+	case err != nil && len(head) == 0:
+		return err
+	default:
+		//没有协议头 按照普通连接处理
+		return nil
+	}
+}
+
+// PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+func (pc *proxyConn) parseV1() error {
+	line, err := pc.r.ReadSlice('\n')
+	if err != nil || len(line) > 107 {
+		return invalidProxyHeader
+	}
+
+	fields := strings.Fields(strings.TrimRight(string(line), "\r\n"))
+	if len(fields) < 2 {
+		return invalidProxyHeader
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil
+	case "TCP4", "TCP6":
+	default:
+		return invalidProxyHeader
+	}
+
+	if len(fields) != 6 {
+		return invalidProxyHeader
+	}
+
+	src, e1 := proxyTCPAddr(fields[2], fields[4])
+	dst, e2 := proxyTCPAddr(fields[3], fields[5])
+	if e1 != nil || e2 != nil {
+		return invalidProxyHeader
+	}
+
+	pc.src, pc.dst = src, dst
+	return nil
+}
+
+func proxyTCPAddr(ip, port string) (*net.TCPAddr, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, invalidProxyHeader
+	}
+
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 0 || p > 65535 {
+		return nil, invalidProxyHeader
+	}
+
+	return &net.TCPAddr{IP: addr, Port: p}, nil
+}
+
+func (pc *proxyConn) parseV2() error {
+	head := make([]byte, 16)
+	if _, err := io.ReadFull(pc.r, head); err != nil {
+		return err
+	}
+
+	if head[12]>>4 != 0x2 {
+		return invalidProxyHeader
+	}
+
+	size := int(binary.BigEndian.Uint16(head[14:16]))
+	body := make([]byte, size)
+	if _, err := io.ReadFull(pc.r, body); err != nil {
+		return err
+	}
+
+	//LOCAL 命令 健康检查等 使用原始地址
+	if head[12]&0x0F == 0x0 {
+		return nil
+	}
+
+	switch head[13] {
+	case 0x11: //TCP over IPv4
+		if size < 12 {
+			return invalidProxyHeader
+		}
+		pc.src = &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))}
+		pc.dst = &net.TCPAddr{IP: net.IP(body[4:8]), Port: int(binary.BigEndian.Uint16(body[10:12]))}
+
+	case 0x21: //TCP over IPv6
+		if size < 36 {
+			return invalidProxyHeader
+		}
+		pc.src = &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))}
+		pc.dst = &net.TCPAddr{IP: net.IP(body[16:32]), Port: int(binary.BigEndian.Uint16(body[34:36]))}
+	}
+
+	return nil
+}
+
+// proxyPeer 返回PROXY协议之前的对端地址
+func proxyPeer(ctx *RequestCtx) net.Addr {
+	c := findConn(ctx.Conn(), func(c net.Conn) bool {
+		_, ok := c.(*proxyConn)
+		return ok
+	})
+
+	if c == nil {
+		return nil
+	}
+	return c.(*proxyConn).Peer()
+}
+
+func parseCIDR(v string) (*net.IPNet, error) {
+	if !strings.Contains(v, "/") {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return nil, errors.New("invalid cidr " + v)
+		}
+
+		//按照字面格式决定掩码 ::ffff:1.2.3.4 也是ipv6的写法
+		if strings.Contains(v, ":") {
+			v = v + "/128"
+		} else {
+			v = v + "/32"
+		}
+	}
+
+	_, cidr, err := net.ParseCIDR(v)
+	if err != nil {
+		return nil, err
+	}
+
+	//ipv4映射的网段转换成ipv4网段 和ipv4地址的匹配保持一致
+	ones, bits := cidr.Mask.Size()
+	if v4 := cidr.IP.To4(); v4 != nil && bits == 8*net.IPv6len {
+		if ones < 96 {
+			return nil, errors.New("invalid cidr " + v + " , ipv4-mapped prefix shorter than /96")
+		}
+		cidr = &net.IPNet{IP: v4, Mask: net.CIDRMask(ones-96, 8*net.IPv4len)}
+	}
+	return cidr, nil
+}
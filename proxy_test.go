@@ -0,0 +1,64 @@
+package fasthttp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyListener 先返回几次临时错误 再返回连接 最后按照关闭处理
+type flakyListener struct {
+	net.Listener
+	errs []error
+	conn net.Conn
+}
+
+func (fl *flakyListener) Accept() (net.Conn, error) {
+	if len(fl.errs) > 0 {
+		err := fl.errs[0]
+		fl.errs = fl.errs[1:]
+		return nil, err
+	}
+
+	if fl.conn != nil {
+		c := fl.conn
+		fl.conn = nil
+		return c, nil
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	return nil, net.ErrClosed
+}
+
+func (fl *flakyListener) Close() error { return nil }
+
+func TestProxyListenerRetry(t *testing.T) {
+	useTestEnv(t)
+
+	c, peer := net.Pipe()
+	defer peer.Close()
+
+	temporary := func(errno syscall.Errno) error {
+		return &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", errno)}
+	}
+
+	fl := &flakyListener{errs: []error{temporary(syscall.EMFILE), temporary(syscall.ECONNABORTED)}, conn: c}
+	pl := newProxyListener(fl, nil, func(remote, local net.Addr) bool { return true })
+
+	got, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("accept after temporary errors got %v", err)
+	}
+
+	if got != c {
+		t.Fatalf("got %v want the pipe conn", got)
+	}
+
+	//监听关闭后Accept返回net.ErrClosed
+	if _, err = pl.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("accept after close got %v", err)
+	}
+}
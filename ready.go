@@ -0,0 +1,78 @@
+package fasthttp
+
+import (
+	"errors"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	serveExitEarly = errors.New("serve exit before ready")
+)
+
+// readyListener 第一次Accept时表示服务已经就绪
+type readyListener struct {
+	net.Listener
+	once  sync.Once
+	ready chan struct{}
+}
+
+func newReadyListener(ln net.Listener) *readyListener {
+	return &readyListener{Listener: ln, ready: make(chan struct{})}
+}
+
+func (rl *readyListener) Accept() (net.Conn, error) {
+	rl.once.Do(func() { close(rl.ready) })
+	return rl.Listener.Accept()
+}
+
+func (rl *readyListener) isReady() bool {
+	select {
+	case <-rl.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *listener) serve(rl *readyListener, done chan error) {
+	err := l.fs.Serve(rl)
+	if rl.isReady() && err != nil {
+		l.fail(err)
+	}
+	done <- err
+}
+
+// wait 等待服务就绪或者启动失败
+func (l *listener) wait(rl *readyListener, done chan error) error {
+	select {
+	case <-rl.ready:
+		return nil
+	case err := <-done:
+		if err == nil {
+			return serveExitEarly
+		}
+		return err
+	}
+}
+
+func (fss *server) fail(err error) {
+	if fss.IsClose() {
+		return
+	}
+
+	fss.mu.Lock()
+	fss.err = err
+	fss.mu.Unlock()
+
+	xEnv.Errorf("%s web serve fail %v", fss.Name(), err)
+	fss.V(lua.VTPanic, time.Now())
+}
+
+func (fss *server) lastError() error {
+	fss.mu.Lock()
+	defer fss.mu.Unlock()
+	return fss.err
+}
@@ -0,0 +1,119 @@
+package fasthttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	request_id_uv_key      = "__request_id__"
+	defaultRequestIDHeader = "X-Request-Id"
+	maxRequestIDSize       = 128
+)
+
+var requestSeq uint64
+
+// newRequestID 32位十六进制随机数 随机数读取失败时使用时间和序号
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16) + strconv.FormatUint(atomic.AddUint64(&requestSeq, 1), 16)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID 只接受长度有限的可见字符 防止日志注入
+func validRequestID(v []byte) bool {
+	if len(v) == 0 || len(v) > maxRequestIDSize {
+		return false
+	}
+
+	for _, c := range v {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func (cfg *config) requestIDHeader() string {
+	if cfg.requestIDName == "" || cfg.requestIDName == "off" {
+		return defaultRequestIDHeader
+	}
+	return cfg.requestIDName
+}
+
+// trustRequestID 直接连接的地址在request_id_trusted中才复用请求头 PROXY协议下检查负载均衡的地址
+func (cfg *config) trustRequestID(ctx *RequestCtx) bool {
+	if len(cfg.requestIDTrusted) == 0 {
+		return false
+	}
+
+	ip := ctx.RemoteIP()
+	if peer := proxyPeer(ctx); peer != nil {
+		ip = addrIP(peer)
+	}
+
+	for _, cidr := range cfg.requestIDTrusted {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestID 给请求分配id 可信来源带了合法的请求头时直接使用
+func (fss *server) requestID(ctx *RequestCtx) string {
+	id := ""
+	if fss.cfg.requestIDName != "off" && fss.cfg.trustRequestID(ctx) {
+		if v := ctx.Request.Header.Peek(fss.cfg.requestIDHeader()); validRequestID(v) {
+			id = string(v)
+		}
+	}
+
+	if id == "" {
+		id = newRequestID()
+	}
+
+	ctx.SetUserValue(request_id_uv_key, id)
+	return id
+}
+
+// echoRequestID 响应中返回请求id ctx.Error会清空响应头 所以在请求结束时设置
+func (fss *server) echoRequestID(ctx *RequestCtx) {
+	if fss.cfg.requestIDName == "off" {
+		return
+	}
+
+	if id := requestIDOf(ctx); id != "" {
+		ctx.Response.Header.Set(fss.cfg.requestIDHeader(), id)
+	}
+}
+
+func requestIDOf(ctx *RequestCtx) string {
+	id, _ := ctx.UserValue(request_id_uv_key).(string)
+	return id
+}
+
+// requestIDHeaderOf 转发请求时使用的请求头名称
+func requestIDHeaderOf(ctx *RequestCtx) string {
+	cfg, ok := ctx.UserValue(web_conf_key).(*config)
+	if !ok {
+		return defaultRequestIDHeader
+	}
+	return cfg.requestIDHeader()
+}
+
+// requestErrorf 请求中的错误日志带上请求id 方便和访问日志关联
+func requestErrorf(ctx *RequestCtx, format string, args ...interface{}) {
+	id := requestIDOf(ctx)
+	if id == "" {
+		xEnv.Errorf(format, args...)
+		return
+	}
+
+	xEnv.Errorf("request_id:%s "+format, append([]interface{}{id}, args...)...)
+}
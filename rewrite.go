@@ -0,0 +1,266 @@
+package fasthttp
+
+import (
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type rewriteFlag int
+
+// rewrite规则的标记 和nginx一致
+const (
+	rewriteNone rewriteFlag = iota
+	rewriteLast
+	rewriteBreak
+	rewriteRedirect
+	rewritePermanent
+)
+
+var rewriteFlagNames = []string{"", "last", "break", "redirect", "permanent"}
+
+// maxRewriteCycles rewrite规则最多执行的轮数 last标记重新匹配算新的一轮 防止死循环
+const maxRewriteCycles = 10
+
+func (f rewriteFlag) String() string {
+	return rewriteFlagNames[f]
+}
+
+func rewriteFlagOf(name string) (rewriteFlag, bool) {
+	for i, item := range rewriteFlagNames {
+		if item == name {
+			return rewriteFlag(i), true
+		}
+	}
+	return rewriteNone, false
+}
+
+// rewriteSeg 替换字符串的片段 group>=0时取正则的分组 name不为空时取k2v变量
+type rewriteSeg struct {
+	text  string
+	group int
+	name  string
+}
+
+type rewriteRule struct {
+	pattern string
+	repl    string
+	flag    rewriteFlag
+	re      *regexp.Regexp
+	segs    []rewriteSeg
+}
+
+// compileReplacement $1 ${1}为正则分组 ${host}等为请求变量 其他的$原样输出
+func compileReplacement(s string) []rewriteSeg {
+	var segs []rewriteSeg
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			segs = append(segs, rewriteSeg{text: text.String(), group: -1})
+			text.Reset()
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			text.WriteByte(s[i])
+			continue
+		}
+
+		switch c := s[i+1]; {
+		case c >= '0' && c <= '9':
+			j := i + 1
+			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+				j++
+			}
+			g, _ := strconv.Atoi(s[i+1 : j])
+			flush()
+			segs = append(segs, rewriteSeg{group: g})
+			i = j - 1
+
+		case c == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end <= 0 {
+				text.WriteByte(s[i])
+				continue
+			}
+
+			name := s[i+2 : i+2+end]
+			flush()
+			if g, err := strconv.Atoi(name); err == nil && g >= 0 {
+				segs = append(segs, rewriteSeg{group: g})
+			} else {
+				segs = append(segs, rewriteSeg{group: -1, name: name})
+			}
+			i += end + 2
+
+		default:
+			text.WriteByte(s[i])
+		}
+	}
+
+	flush()
+	return segs
+}
+
+func newRewriteRule(pattern, repl string, flag rewriteFlag) (*rewriteRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rewriteRule{
+		pattern: pattern,
+		repl:    repl,
+		flag:    flag,
+		re:      re,
+		segs:    compileReplacement(repl),
+	}, nil
+}
+
+func (rule *rewriteRule) String() string {
+	if rule.flag == rewriteNone {
+		return rule.pattern + " " + rule.repl
+	}
+	return rule.pattern + " " + rule.repl + " " + rule.flag.String()
+}
+
+// expand 按照匹配结果生成新的地址
+func (rule *rewriteRule) expand(ctx *RequestCtx, src string, match []int) string {
+	var buf strings.Builder
+	for _, seg := range rule.segs {
+		switch {
+		case seg.group >= 0:
+			if 2*seg.group+1 < len(match) && match[2*seg.group] >= 0 {
+				buf.WriteString(src[match[2*seg.group]:match[2*seg.group+1]])
+			}
+		case seg.name != "":
+			if lv := k2v(ctx, seg.name); lv != lua.LNil {
+				buf.WriteString(lv.String())
+			}
+		default:
+			buf.WriteString(seg.text)
+		}
+	}
+	return buf.String()
+}
+
+// withArgs 替换结果以?结尾时丢弃原来的参数 否则追加在后面
+func withArgs(ctx *RequestCtx, target string) string {
+	if strings.HasSuffix(target, "?") {
+		return target[:len(target)-1]
+	}
+
+	args := ctx.URI().QueryString()
+	if len(args) == 0 {
+		return target
+	}
+
+	if strings.IndexByte(target, '?') >= 0 {
+		return target + "&" + string(args)
+	}
+	return target + "?" + string(args)
+}
+
+func isAbsoluteURL(v string) bool {
+	return strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://")
+}
+
+// setURI 内部重写 只修改路径和参数
+func setURI(ctx *RequestCtx, target string) {
+	uri := ctx.URI()
+	if i := strings.IndexByte(target, '?'); i >= 0 {
+		uri.SetPath(target[:i])
+		uri.SetQueryString(target[i+1:])
+		return
+	}
+
+	uri.SetPath(target)
+	uri.SetQueryString("")
+}
+
+// rewriteURI 路由之前按照声明顺序执行rewrite规则 重定向或者循环次数过多时结束请求返回true
+func (r *vRouter) rewriteURI(ctx *RequestCtx) bool {
+	if r == nil || len(r.rewrites) == 0 {
+		return false
+	}
+
+	for cycle := 0; cycle < maxRewriteCycles; cycle++ {
+		restart := false
+		for _, rule := range r.rewrites {
+			path := string(ctx.URI().Path())
+			match := rule.re.FindStringSubmatchIndex(path)
+			if match == nil {
+				continue
+			}
+
+			target := withArgs(ctx, rule.expand(ctx, path, match))
+			switch {
+			case rule.flag == rewritePermanent:
+				ctx.Redirect(target, fasthttp.StatusMovedPermanently)
+				return true
+			case rule.flag == rewriteRedirect || isAbsoluteURL(target):
+				ctx.Redirect(target, fasthttp.StatusFound)
+				return true
+			}
+
+			setURI(ctx, target)
+			if rule.flag == rewriteBreak {
+				return false
+			}
+
+			if rule.flag == rewriteLast {
+				restart = true
+				break
+			}
+		}
+
+		if !restart {
+			return false
+		}
+	}
+
+	requestErrorf(ctx, "rewrite cycle over %d times %s", maxRewriteCycles, ctx.URI().Path())
+	ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+	return true
+}
+
+// rewriteL r.rewrite(pattern , replacement , [flag]) 添加rewrite规则
+func (r *vRouter) rewriteL(L *lua.LState) int {
+	pattern := L.CheckString(1)
+	repl := L.CheckString(2)
+
+	flag := rewriteNone
+	if L.GetTop() >= 3 {
+		f, ok := rewriteFlagOf(L.CheckString(3))
+		if !ok {
+			L.RaiseError("invalid rewrite flag %s", L.CheckString(3))
+			return 0
+		}
+		flag = f
+	}
+
+	rule, err := newRewriteRule(pattern, repl, flag)
+	if err != nil {
+		L.RaiseError("invalid rewrite pattern %s %v", pattern, err)
+		return 0
+	}
+
+	r.rewrites = append(r.rewrites, rule)
+	return 0
+}
+
+func (r *vRouter) rewriteRules() []string {
+	if len(r.rewrites) == 0 {
+		return nil
+	}
+
+	rules := make([]string, 0, len(r.rewrites))
+	for _, rule := range r.rewrites {
+		rules = append(rules, rule.String())
+	}
+	return rules
+}
@@ -0,0 +1,68 @@
+package fasthttp
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func rewriteCtx(uri string) *RequestCtx {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	req.SetRequestURI(uri)
+
+	ctx := &RequestCtx{}
+	ctx.Init(req, nil, nil)
+	return ctx
+}
+
+func TestRewriteBreak(t *testing.T) {
+	useTestEnv(t)
+
+	rule, err := newRewriteRule("^/old/(.*)$", "/new/$1", rewriteBreak)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := &vRouter{rewrites: []*rewriteRule{rule}}
+	if rules := r.rewriteRules(); len(rules) != 1 || rules[0] != "^/old/(.*)$ /new/$1 break" {
+		t.Fatalf("rules got %v", rules)
+	}
+
+	ctx := rewriteCtx("http://a.com/old/x?q=1")
+	if r.rewriteURI(ctx) {
+		t.Fatal("break should not end the request")
+	}
+
+	if uri := string(ctx.URI().RequestURI()); uri != "/new/x?q=1" {
+		t.Fatalf("uri got %s", uri)
+	}
+}
+
+func TestRewriteCycles(t *testing.T) {
+	useTestEnv(t)
+
+	//n条last规则依次改写 /c0 -> /c1 ... 需要n+1轮
+	chain := func(n int) *vRouter {
+		r := &vRouter{}
+		for i := 0; i < n; i++ {
+			rule, err := newRewriteRule(fmt.Sprintf("^/c%d$", i), fmt.Sprintf("/c%d", i+1), rewriteLast)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.rewrites = append(r.rewrites, rule)
+		}
+		return r
+	}
+
+	ctx := rewriteCtx("http://a.com/c0")
+	if chain(maxRewriteCycles - 1).rewriteURI(ctx) {
+		t.Fatalf("%d cycles got status %d", maxRewriteCycles, ctx.Response.StatusCode())
+	}
+
+	ctx = rewriteCtx("http://a.com/c0")
+	if !chain(maxRewriteCycles).rewriteURI(ctx) || ctx.Response.StatusCode() != fasthttp.StatusInternalServerError {
+		t.Fatalf("%d cycles should fail", maxRewriteCycles+1)
+	}
+}
@@ -0,0 +1,63 @@
+package fasthttp
+
+import (
+	"github.com/valyala/fasthttp"
+	"sync/atomic"
+)
+
+const route_uv_key = "__web_route__"
+
+// route 注册的路由 统计命中次数 指标和状态页按照路由模式统计
+type route struct {
+	method  string
+	path    string
+	count   uint64
+	chains  *HandleChains
+	handles []string //没有handle链的路由 例如FILE
+}
+
+func (rt *route) Count() uint64 {
+	return atomic.LoadUint64(&rt.count)
+}
+
+// add 注册路由并记录 请求中可以通过routeOf获取命中的路由
+func (r *vRouter) add(method, path string, chains *HandleChains, handler fasthttp.RequestHandler) *route {
+	rt := &route{method: method, path: path, chains: chains}
+
+	r.mu.Lock()
+	r.routes = append(r.routes, rt)
+	r.mu.Unlock()
+
+	fn := func(ctx *RequestCtx) {
+		atomic.AddUint64(&rt.count, 1)
+		ctx.SetUserValue(route_uv_key, rt)
+		handler(ctx)
+	}
+
+	switch method {
+	case "ANY":
+		r.r.ANY(path, fn)
+	default:
+		r.r.Handle(method, path, fn)
+	}
+	return rt
+}
+
+// Handles 路由的handle链描述
+func (rt *route) Handles() []string {
+	return append(rt.chains.Names(), rt.handles...)
+}
+
+func (r *vRouter) Routes() []*route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	routes := make([]*route, len(r.routes))
+	copy(routes, r.routes)
+	return routes
+}
+
+func routeOf(ctx *RequestCtx) *route {
+	rt, _ := ctx.UserValue(route_uv_key).(*route)
+	return rt
+}
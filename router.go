@@ -4,6 +4,7 @@ import (
 	"github.com/fasthttp/router"
 	"github.com/valyala/fasthttp"
 	"github.com/vela-ssoc/vela-kit/lua"
+	"sync"
 )
 
 type RequestCtx = fasthttp.RequestCtx
@@ -13,12 +14,15 @@ type vRouter struct {
 	//获取名称
 	name string
 
+	//作为vhost时的主机名
+	vhost string
+
 	//上次修改时间
 	mtime int64 //时间
 
-	//匹配
-	match  func(string) bool
-	method string
+	//vhost主机名匹配
+	host   *hostPattern
+	method methodSet
 
 	accessOff string
 	access    func(ctx *RequestCtx) []byte
@@ -29,8 +33,22 @@ type vRouter struct {
 	//handler处理脚本路径
 	handler string
 
+	//SNI证书
+	cert string
+	key  string
+
 	close       *lua.LFunction
 	interceptor *lua.LFunction
+	phase       phases
+	rewrites    []*rewriteRule
+
+	//请求统计
+	count uint64
+
+	//注册的路由
+	mu       sync.RWMutex
+	routes   []*route
+	notFound *HandleChains
 
 	//缓存路由
 	r *router.Router
@@ -40,7 +58,22 @@ func (r *vRouter) AccessLogOff() bool {
 	return r.accessOff == "off"
 }
 
+// closeUpstreams 重新加载或者关闭时 旧路由中web.proxy的HostClient不再使用
+func (r *vRouter) closeUpstreams() {
+	r.mu.RLock()
+	for _, rt := range r.routes {
+		rt.chains.closeUpstreams()
+	}
+	r.mu.RUnlock()
+
+	r.notFound.closeUpstreams()
+	for _, hc := range r.phase {
+		hc.closeUpstreams()
+	}
+}
+
 func (r *vRouter) Close() error {
+	r.closeUpstreams()
 	if r.close == nil {
 		return nil
 	}
@@ -63,10 +96,37 @@ func (r *vRouter) Name() string {
 }
 
 func (r *vRouter) Match(v string) bool {
+	if r.host != nil {
+		return r.host.match(v)
+	}
 	return r.name == v
 }
 
+func (r *vRouter) Prefer(other PoolItemIFace) bool {
+	o, ok := other.(*vRouter)
+	if !ok || o.host == nil {
+		return r.host != nil
+	}
+
+	if r.host == nil {
+		return false
+	}
+	return r.host.prefer(o.host)
+}
+
+func (r *vRouter) certificate() (*certificate, error) {
+	if r.cert == "" || r.key == "" {
+		return nil, nil
+	}
+
+	return requireCertificate(r.cert, r.key)
+}
+
 func (r *vRouter) do(ctx *RequestCtx) {
+	if r.notAllowed(ctx) {
+		return
+	}
+
 	r.r.Handler(ctx)
 
 	if r.interceptor == nil {
@@ -76,8 +136,12 @@ func (r *vRouter) do(ctx *RequestCtx) {
 	co := newLuaThread(ctx)
 	cp := xEnv.P(r.interceptor)
 
+	sp := startSpan(ctx, "interceptor", spanKindInternal)
 	err := co.CallByParam(cp)
+	sp.Error(err)
+	sp.End()
 	if err != nil {
+		requestErrorf(ctx, "router interceptor error %v", err)
 		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
 		ctx.SetBodyString(err.Error())
 		return
@@ -87,6 +151,7 @@ func (r *vRouter) do(ctx *RequestCtx) {
 func newRouter(co *lua.LState, tab lua.LValue) *vRouter {
 	r := router.New()
 	r.PanicHandler = panicHandler
+	r.NotFound = defaultNotFound
 
 	v := &vRouter{r: r, variables: map[string]string{}}
 
@@ -5,6 +5,7 @@ import (
 	"github.com/valyala/fasthttp"
 	"github.com/vela-ssoc/vela-kit/auxlib"
 	"github.com/vela-ssoc/vela-kit/lua"
+	"strings"
 )
 
 func (r *vRouter) String() string                         { return fmt.Sprintf("fasthttp.router %p", r) }
@@ -14,40 +15,36 @@ func (r *vRouter) AssertString() (string, bool)           { return "", false }
 func (r *vRouter) AssertFunction() (*lua.LFunction, bool) { return nil, false }
 func (r *vRouter) Peek() lua.LValue                       { return r }
 
-func (r *vRouter) handleIndexFn(L *lua.LState, method string) *lua.LFunction {
+func (g *routeGroup) handleIndexFn(L *lua.LState, method string) *lua.LFunction {
+	r := g.r
 	fn := func(co *lua.LState) int {
-		path := co.CheckString(1)
-		chains := checkHandleChains(co, 1)
-		r.r.Handle(method, path, func(ctx *RequestCtx) { chains.do(ctx, r.handler) })
+		path := g.path(co.CheckString(1))
+		chains := g.chains(checkHandleChains(co, 1))
+		r.add(method, path, chains, func(ctx *RequestCtx) { chains.do(ctx, r.handler) })
 		return 0
 	}
 	return L.NewFunction(fn)
 }
 
-func (r *vRouter) anyIndexFn(L *lua.LState) *lua.LFunction {
-	fn := func(co *lua.LState) int {
-		path := co.CheckString(1)
-		chains := checkHandleChains(co, 1)
-		r.r.ANY(path, func(ctx *fasthttp.RequestCtx) { chains.do(ctx, r.handler) })
-		return 0
-	}
-
-	return L.NewFunction(fn)
+func (g *routeGroup) anyIndexFn(L *lua.LState) *lua.LFunction {
+	return g.handleIndexFn(L, "ANY")
 }
 
 func (r *vRouter) notFoundIndexFn(L *lua.LState) *lua.LFunction {
 	fn := func(co *lua.LState) int {
 		chains := checkHandleChains(co, 1)
+		r.notFound = chains
 		r.r.NotFound = func(ctx *fasthttp.RequestCtx) { chains.do(ctx, r.handler) }
 		return 0
 	}
 	return L.NewFunction(fn)
 }
 
-func (r *vRouter) fileIndexFn(L *lua.LState) *lua.LFunction {
+func (g *routeGroup) fileIndexFn(L *lua.LState) *lua.LFunction {
+	r := g.r
 	fn := func(vm *lua.LState) (ret int) {
 		n := vm.GetTop()
-		path := vm.CheckString(1)
+		path := g.path(vm.CheckString(1))
 		root := vm.CheckString(2)
 		fs := &fasthttp.FS{
 			Root:               root,
@@ -63,7 +60,7 @@ func (r *vRouter) fileIndexFn(L *lua.LState) *lua.LFunction {
 				co := newLuaThread(ctx)
 				err := co.CallByParam(cp)
 				if err != nil {
-					xEnv.Errorf("%v", err)
+					requestErrorf(ctx, "%v", err)
 					return ctx.Path()
 				}
 
@@ -75,7 +72,33 @@ func (r *vRouter) fileIndexFn(L *lua.LState) *lua.LFunction {
 			}
 		}
 
-		r.r.ServeFilesCustom(path, fs)
+		//同router.ServeFilesCustom 通过add注册方便统计
+		const suffix = "/{filepath:*}"
+		if !strings.HasSuffix(path, suffix) {
+			vm.RaiseError("path must end with %s in path '%s'", suffix, path)
+			return
+		}
+
+		if strip := strings.Count(path[:len(path)-len(suffix)], "/"); fs.PathRewrite == nil && strip > 0 {
+			fs.PathRewrite = fasthttp.NewPathSlashesStripper(strip)
+		}
+
+		handler := fs.NewRequestHandler()
+
+		//分组的handle在文件服务之前执行
+		head := g.head
+		if head != nil && head.cap > 0 {
+			serveFile := handler
+			handler = func(ctx *RequestCtx) {
+				if head.run(ctx, r.handler) {
+					return
+				}
+				serveFile(ctx)
+			}
+		}
+
+		rt := r.add(fasthttp.MethodGet, path, head, handler)
+		rt.handles = []string{"file " + root}
 		return
 	}
 
@@ -107,13 +130,16 @@ func (r *vRouter) varL(L *lua.LState) int {
 func (r *vRouter) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE":
-		return r.handleIndexFn(L, key)
+		return r.root().handleIndexFn(L, key)
 
 	case "FILE", "file":
-		return r.fileIndexFn(L)
+		return r.root().fileIndexFn(L)
 
 	case "ANY", "any":
-		return r.anyIndexFn(L)
+		return r.root().anyIndexFn(L)
+
+	case "group":
+		return r.root().groupIndexFn(L)
 
 	case "not_found", "default":
 		return r.notFoundIndexFn(L)
@@ -134,6 +160,17 @@ func (r *vRouter) Index(L *lua.LState, key string) lua.LValue {
 
 	case "interceptor":
 		return lua.NewFunction(r.interceptorL)
+
+	case "routes":
+		return lua.NewFunction(r.routesL)
+
+	//rewrite阶段通过r.rewrite = {...}设置
+	case "rewrite":
+		return lua.NewFunction(r.rewriteL)
+
+	case "access", "header_filter", "body_filter", "log":
+		p, _ := phaseOf(key)
+		return r.phase.indexFn(L, p)
 	}
 
 	return lua.LNil
@@ -175,10 +212,19 @@ func (r *vRouter) NewIndex(L *lua.LState, key string, val lua.LValue) {
 
 	switch key {
 	case "method":
-		r.method = val.String()
+		r.method = checkMethodSet(L, val)
 
 	case "interceptor":
 		r.interceptor = lua.IsFunc(val)
+
+	case "rewrite", "access", "header_filter", "body_filter", "log":
+		r.phase.set(key, val)
+
+	case "cert":
+		r.cert = val.String()
+
+	case "key":
+		r.key = val.String()
 	}
 
 }
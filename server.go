@@ -1,12 +1,13 @@
 package fasthttp
 
 import (
+	"fmt"
 	"github.com/valyala/fasthttp"
-	"github.com/valyala/fasthttp/reuseport"
 	"github.com/vela-ssoc/vela-kit/auxlib"
 	"github.com/vela-ssoc/vela-kit/lua"
-	"net"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,10 +18,17 @@ type server struct {
 	cfg *config
 
 	//监听
-	ln net.Listener
+	listeners []*listener
 
-	//中间对象
-	fs *fasthttp.Server
+	//正在处理的请求和活跃连接
+	inflight int64
+	conns    *connTracker
+	stats    *serverStats
+	metrics  *serverMetrics
+
+	//运行中的错误
+	mu  sync.Mutex
+	err error
 
 	vhost *pool
 }
@@ -28,7 +36,7 @@ type server struct {
 func newServer(cfg *config) *server {
 	cnn := &conversion{}
 	cnn.pretreatment(defaultAccessJsonFormat)
-	srv := &server{cfg: cfg, vhost: newPool()}
+	srv := &server{cfg: cfg, vhost: newPool(), conns: newConnTracker(), stats: newServerStats(), metrics: newServerMetrics()}
 	srv.V(lua.VTInit, typeof)
 	return srv
 }
@@ -42,6 +50,10 @@ func (fss *server) Close() error {
 		return nil
 	}
 
+	//先等待请求处理完成 再清理路由
+	fss.stop()
+	metricsServers.unregister(fss)
+
 	if fss.cfg.fd != nil {
 		_ = fss.cfg.fd.Close()
 		fss.cfg.fd = nil
@@ -49,64 +61,53 @@ func (fss *server) Close() error {
 
 	xEnv.Errorf("%s web vhost clear", fss.Name())
 
-	routerPool.clear(fss.cfg.router)
-	handlePool.clear(fss.cfg.handler)
-	if fss.fs == nil {
-		goto done
+	if fss.cfg.r != nil {
+		if e := fss.cfg.r.Close(); e != nil {
+			xEnv.Errorf("%s web router on_exit error %v", fss.Name(), e)
+		}
 	}
 
-	if e := fss.fs.Shutdown(); e != nil {
-		xEnv.Errorf("%s web close error %v", fss.Name(), e)
-		fss.V(lua.VTPanic)
-		return e
+	//server自己的阶段和default中的web.proxy
+	fss.cfg.notFound.closeUpstreams()
+	for _, hc := range fss.cfg.phase {
+		hc.closeUpstreams()
+	}
+
+	routerPool.clear(fss.cfg.router)
+	handlePool.clear(fss.cfg.handler)
+	if fss.cfg.cert != "" {
+		certPool.clear(fss.cfg.cert)
 	}
 
-done:
 	fss.V(lua.VTClose)
 	return nil
 }
 
-func (fss *server) Listen() (net.Listener, error) {
-	var network, address string
-
-	network = fss.cfg.bind.Scheme()
-	switch network {
-	case "unix", "pipe":
-		address = fss.cfg.bind.Path()
-	default:
-		address = fss.cfg.bind.Host()
-
-	}
-
-	if fss.cfg.reuseport == "on" {
-		return reuseport.Listen(network, address)
+// notFound 没有对应的vhost 交给默认路由http.r处理
+func (fss *server) notFound(ctx *RequestCtx) {
+	if fss.cfg.r == nil {
+		defaultNotFound(ctx)
+		return
 	}
 
-	return net.Listen(network, address)
+	atomic.AddUint64(&fss.cfg.r.count, 1)
+	fss.cfg.r.do(ctx)
 }
 
-func (fss *server) keepalive() bool {
-	if fss.cfg.keepalive == "on" {
-		return true
+// defaultNotFound 路由没有命中 优先级: router的not_found > web的default > 内置
+func defaultNotFound(ctx *RequestCtx) {
+	cfg, ok := ctx.UserValue(web_conf_key).(*config)
+	if ok && cfg.notFound != nil {
+		cfg.notFound.do(ctx, cfg.handler)
+		return
 	}
-	return false
-}
 
-func (fss *server) notFoundBody(ctx *RequestCtx) {
 	ctx.Response.SetStatusCode(fasthttp.StatusNotFound)
 	ctx.Response.SetBodyString("not found")
 }
 
-func (fss *server) notFound(ctx *RequestCtx) {
-	if fss.cfg.r == nil {
-		fss.notFoundBody(ctx)
-		return
-	}
-
-	fss.cfg.r.do(ctx)
-}
-
 func (fss *server) invalid(ctx *RequestCtx, err error) {
+	requestErrorf(ctx, "%s web %s %v", fss.Name(), ctx.Host(), err)
 	ctx.Response.SetStatusCode(fasthttp.StatusInternalServerError)
 	ctx.Response.SetBodyString(err.Error())
 }
@@ -137,7 +138,7 @@ done:
 
 	info, err := xEnv.Region(ip)
 	if err != nil {
-		xEnv.Errorf("%v", err)
+		requestErrorf(ctx, "%v", err)
 		return
 	}
 
@@ -190,11 +191,11 @@ done:
 //}
 
 func (fss *server) require(ctx *RequestCtx) (*vRouter, error) {
-	host := lua.B2S(ctx.Request.Header.Host())
+	//忽略端口和大小写
+	host := normalizeHost(lua.B2S(ctx.Request.Header.Host()))
 
-	item := fss.vhost.Get(host)
-	if item != nil {
-		return item.val.(*vRouter), nil
+	if r := fss.lookupVhost(host); r != nil {
+		return r, nil
 	}
 
 	return requireRouter(fss.cfg.router, fss.cfg.handler, host)
@@ -209,7 +210,23 @@ func (fss *server) setUserValue(r *vRouter, ctx *RequestCtx) {
 }
 
 func (fss *server) Handler(ctx *RequestCtx) {
+	start := time.Now()
+	atomic.AddInt64(&fss.inflight, 1)
+	defer atomic.AddInt64(&fss.inflight, -1)
+
 	ctx.SetUserValue(web_conf_key, fss.cfg)
+	fss.requestID(ctx)
+	sp := fss.startRequestSpan(ctx)
+	if info := connOf(ctx); info != nil {
+		atomic.AddUint64(&info.requests, 1)
+	}
+
+	if fss.status(ctx) {
+		fss.echoRequestID(ctx)
+		fss.endRequestSpan(sp, nil, ctx)
+		fss.stats.record(ctx.Response.StatusCode())
+		return
+	}
 
 	r, err := fss.require(ctx)
 	//是否获取IP地址位置信息
@@ -217,20 +234,24 @@ func (fss *server) Handler(ctx *RequestCtx) {
 
 	fss.setUserValue(r, ctx)
 
-	if err != nil {
-		if os.IsNotExist(err) {
-			fss.notFound(ctx)
-			goto done
-		}
-
+	if err != nil && !os.IsNotExist(err) {
 		fss.invalid(ctx, err)
 		goto done
 	}
 
-	r.do(ctx)
+	fss.serve(r, ctx)
 
 done:
+	fss.echoRequestID(ctx)
+	fss.endRequestSpan(sp, r, ctx)
+	fss.stats.record(ctx.Response.StatusCode())
+	fss.metrics.observe(r, ctx, start)
+	if r != nil {
+		atomic.AddUint64(&r.count, 1)
+	}
+
 	fss.Log(r, ctx)
+	fss.logPhase(r, ctx)
 
 	//释放co
 	freeLuaThread(ctx)
@@ -239,23 +260,42 @@ done:
 func (fss *server) Start() error {
 	xEnv.Errorf("%s fasthttp start ...", fss.Name())
 
-	ln, err := fss.Listen()
-	if err != nil {
-		return err
+	if fss.cfg.secure() {
+		if _, err := requireCertificate(fss.cfg.cert, fss.cfg.key); err != nil {
+			return err
+		}
 	}
 
-	fss.fs = &fasthttp.Server{
-		Handler:         fss.Handler,
-		TCPKeepalive:    fss.keepalive(),
-		ReadTimeout:     time.Duration(fss.cfg.bind.Int("read_timeout")) * time.Second,
-		IdleTimeout:     time.Duration(fss.cfg.bind.Int("idle_timeout")) * time.Second,
-		CloseOnShutdown: true,
+	//重新配置时先关闭旧的监听 相同bind的socket由新监听接管
+	fss.stop()
+
+	fss.mu.Lock()
+	fss.err = nil
+	fss.mu.Unlock()
+
+	fss.listeners = make([]*listener, 0, len(fss.cfg.bind))
+	for _, bind := range fss.cfg.bind {
+		l := newListener(fss, bind)
+		if err := l.Start(); err != nil {
+			fss.stop()
+			return fmt.Errorf("%s listen fail %v", bind.String(), err)
+		}
+		fss.listeners = append(fss.listeners, l)
 	}
-	fss.ln = ln
-	go func() {
-		err = fss.fs.Serve(ln)
-	}()
 
-	time.Sleep(500 * time.Millisecond)
-	return err
+	metricsServers.register(fss)
+	return nil
+}
+
+// stop 等待请求处理完成后关闭所有监听
+func (fss *server) stop() {
+	if len(fss.listeners) == 0 {
+		return
+	}
+
+	fss.drain()
+	for _, l := range fss.listeners {
+		_ = l.Close()
+	}
+	fss.listeners = nil
 }
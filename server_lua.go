@@ -24,7 +24,15 @@ func (fss *server) vHost(L *lua.LState) int {
 		return 0
 	}
 
-	fss.vhost.insert(hostname, r)
+	if _, err := r.certificate(); err != nil {
+		L.RaiseError("%s vhost certificate error %v", hostname, err)
+		return 0
+	}
+
+	if err := fss.addVhost(hostname, r); err != nil {
+		L.RaiseError("%s vhost %v", hostname, err)
+		return 0
+	}
 	xEnv.Errorf("add %s router succeed", hostname)
 	L.Push(r)
 	return 1
@@ -82,6 +90,12 @@ func (fss *server) outputL(L *lua.LState) int {
 	return 0
 }
 
+// traceL span 输出 和output一样使用lua.Writer
+func (fss *server) traceL(L *lua.LState) int {
+	fss.cfg.trace = checkOutputSdk(L, L.Get(1))
+	return 0
+}
+
 func (fss *server) startL(L *lua.LState) int {
 	xEnv.Start(L, fss).From(L.CodeVM()).Do()
 	return 0
@@ -124,6 +138,39 @@ func (fss *server) varL(L *lua.LState) int {
 	return 0
 }
 
+func (fss *server) allowL(L *lua.LState) int {
+	for i := 1; i <= L.GetTop(); i++ {
+		fss.cfg.acl.Allow(checkCIDR(L, L.Get(i))...)
+	}
+	return 0
+}
+
+func (fss *server) denyL(L *lua.LState) int {
+	for i := 1; i <= L.GetTop(); i++ {
+		fss.cfg.acl.Deny(checkCIDR(L, L.Get(i))...)
+	}
+	return 0
+}
+
+func (fss *server) onConnectL(L *lua.LState) int {
+	fss.cfg.onConnect.Store(L.CheckFunction(1))
+	return 0
+}
+
+func (fss *server) onCloseL(L *lua.LState) int {
+	fss.cfg.onClose.Store(L.CheckFunction(1))
+	return 0
+}
+
+// statusL http.status("/__status" , "10.0.0.0/8" ...)
+func (fss *server) statusL(L *lua.LState) int {
+	fss.cfg.status = L.CheckString(1)
+	for i := 2; i <= L.GetTop(); i++ {
+		fss.cfg.statusACL.Allow(checkCIDR(L, L.Get(i))...)
+	}
+	return 0
+}
+
 func (fss *server) Index(L *lua.LState, key string) lua.LValue {
 	switch key {
 	case "vhost":
@@ -140,8 +187,29 @@ func (fss *server) Index(L *lua.LState, key string) lua.LValue {
 		return L.NewFunction(fss.addrL)
 	case "to":
 		return L.NewFunction(fss.outputL)
+	case "trace":
+		return L.NewFunction(fss.traceL)
 	case "var":
 		return lua.NewFunction(fss.varL)
+	case "allow":
+		return L.NewFunction(fss.allowL)
+	case "deny":
+		return L.NewFunction(fss.denyL)
+	case "on_connect":
+		return L.NewFunction(fss.onConnectL)
+	case "on_close":
+		return L.NewFunction(fss.onCloseL)
+	case "status":
+		return L.NewFunction(fss.statusL)
+	case "rejected":
+		return lua.LNumber(fss.cfg.acl.Rejected())
+	case "routes":
+		return L.NewFunction(fss.routesL)
+	case "rewrite", "access", "header_filter", "body_filter", "log":
+		p, _ := phaseOf(key)
+		return fss.cfg.phase.indexFn(L, p)
+	case "config":
+		return L.NewFunction(fss.configL)
 
 	case "r":
 		return fss.cfg.r
@@ -0,0 +1,335 @@
+package fasthttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"html"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serverStats 请求总数和状态码统计
+type serverStats struct {
+	requests uint64
+	codes    [600]uint64
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{}
+}
+
+func (st *serverStats) record(code int) {
+	atomic.AddUint64(&st.requests, 1)
+	if code > 0 && code < len(st.codes) {
+		atomic.AddUint64(&st.codes[code], 1)
+	}
+}
+
+func (st *serverStats) Requests() uint64 {
+	return atomic.LoadUint64(&st.requests)
+}
+
+func (st *serverStats) Codes() map[string]uint64 {
+	codes := make(map[string]uint64)
+	for code := range st.codes {
+		if n := atomic.LoadUint64(&st.codes[code]); n > 0 {
+			codes[strconv.Itoa(code)] = n
+		}
+	}
+	return codes
+}
+
+type compileError struct {
+	Name  string    `json:"name"`
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// compileLog 每个文件最近一次编译失败的原因 编译成功后删除
+type compileLog struct {
+	mu    sync.Mutex
+	items map[string]compileError
+}
+
+var compileErrors = &compileLog{items: make(map[string]compileError)}
+
+func recordCompile(pool, name string, err error) {
+	//文件不存在是正常的查找失败
+	if err != nil && os.IsNotExist(err) {
+		return
+	}
+
+	compileCounter.add(pool, err)
+
+	compileErrors.mu.Lock()
+	defer compileErrors.mu.Unlock()
+
+	if err == nil {
+		delete(compileErrors.items, name)
+		return
+	}
+
+	compileErrors.items[name] = compileError{Name: name, Error: err.Error(), Time: time.Now()}
+}
+
+func (cl *compileLog) List() []compileError {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	list := make([]compileError, 0, len(cl.items))
+	for _, item := range cl.items {
+		list = append(list, item)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Time.After(list[j].Time) })
+	return list
+}
+
+type statusCount struct {
+	Name  string `json:"name"`
+	Count uint64 `json:"count"`
+}
+
+type statusRoute struct {
+	Vhost  string `json:"vhost"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Count  uint64 `json:"count"`
+}
+
+type statusSnapshot struct {
+	Name        string            `json:"name"`
+	Uptime      string            `json:"uptime"`
+	Connections int               `json:"connections"`
+	Inflight    int64             `json:"inflight"`
+	Requests    uint64            `json:"requests"`
+	Rejected    uint64            `json:"rejected"`
+	Status      map[string]uint64 `json:"status"`
+	Vhosts      []statusCount     `json:"vhosts"`
+	Routes      []statusRoute     `json:"routes"`
+	Handles     []statusCount     `json:"handles"`
+	Pools       map[string]int    `json:"pools"`
+	Errors      []compileError    `json:"errors"`
+}
+
+// activeConns fasthttp和h2的活跃连接
+func (fss *server) activeConns() int {
+	n := fss.conns.Len()
+	for _, l := range fss.listeners {
+		if h2, ok := l.ln.(*h2Listener); ok {
+			n += h2.Len()
+		}
+	}
+	return n
+}
+
+// routerFilePrefix 路由文件的名称前缀 和同名的vhost区分开
+const routerFilePrefix = "file:"
+
+// routers 当前server可见的所有路由 vhost 路由文件(file:文件名) 和默认路由
+func (fss *server) routers() map[string]*vRouter {
+	routers := make(map[string]*vRouter)
+	fss.vhost.Range(func(key string, val PoolItemIFace) {
+		if r, ok := val.(*vRouter); ok {
+			routers[key] = r
+		}
+	})
+
+	routerPool.Range(func(key string, val PoolItemIFace) {
+		if !strings.HasPrefix(key, fss.cfg.router) {
+			return
+		}
+
+		if r, ok := val.(*vRouter); ok {
+			routers[routerFilePrefix+strings.TrimSuffix(filepath.Base(key), ".lua")] = r
+		}
+	})
+
+	if fss.cfg.r != nil {
+		routers["default"] = fss.cfg.r
+	}
+	return routers
+}
+
+func (fss *server) snapshot() *statusSnapshot {
+	snap := &statusSnapshot{
+		Name:        fss.Name(),
+		Connections: fss.activeConns(),
+		Inflight:    atomic.LoadInt64(&fss.inflight),
+		Requests:    fss.stats.Requests(),
+		Rejected:    fss.cfg.acl.Rejected(),
+		Status:      fss.stats.Codes(),
+		Errors:      compileErrors.List(),
+		Pools: map[string]int{
+			"vhost":  fss.vhost.Size(),
+			"router": routerPool.Size(),
+			"handle": handlePool.Size(),
+			"cert":   certPool.Size(),
+		},
+	}
+
+	if !fss.Uptime.IsZero() {
+		snap.Uptime = time.Since(fss.Uptime).Truncate(time.Second).String()
+	}
+
+	for host, r := range fss.routers() {
+		snap.Vhosts = append(snap.Vhosts, statusCount{Name: host, Count: atomic.LoadUint64(&r.count)})
+		for _, rt := range r.Routes() {
+			snap.Routes = append(snap.Routes, statusRoute{Vhost: host, Method: rt.method, Path: rt.path, Count: rt.Count()})
+
+			//路由中直接定义的handle
+			if rt.chains == nil {
+				continue
+			}
+
+			for i := 0; i < rt.chains.cap; i++ {
+				if hd, ok := rt.chains.data[i].(*handle); ok {
+					name := fmt.Sprintf("%s %s %s#%d", host, rt.method, rt.path, i)
+					snap.Handles = append(snap.Handles, statusCount{Name: name, Count: uint64(atomic.LoadUint32(&hd.count))})
+				}
+			}
+		}
+	}
+
+	handlePool.Range(func(key string, val PoolItemIFace) {
+		if !strings.HasPrefix(key, fss.cfg.handler) {
+			return
+		}
+
+		if hd, ok := val.(*handle); ok {
+			snap.Handles = append(snap.Handles, statusCount{Name: key, Count: uint64(atomic.LoadUint32(&hd.count))})
+		}
+	})
+
+	sort.Slice(snap.Vhosts, func(i, j int) bool { return snap.Vhosts[i].Name < snap.Vhosts[j].Name })
+	sort.Slice(snap.Routes, func(i, j int) bool {
+		if snap.Routes[i].Vhost != snap.Routes[j].Vhost {
+			return snap.Routes[i].Vhost < snap.Routes[j].Vhost
+		}
+		return snap.Routes[i].Path < snap.Routes[j].Path
+	})
+	sort.Slice(snap.Handles, func(i, j int) bool { return snap.Handles[i].Name < snap.Handles[j].Name })
+	return snap
+}
+
+// statusAllow 没有配置白名单时只允许本机访问
+func (fss *server) statusAllow(ctx *RequestCtx) bool {
+	ip := ctx.RemoteIP()
+	if fss.cfg.statusACL.empty() {
+		return ip.IsLoopback()
+	}
+	return fss.cfg.statusACL.permit(ip)
+}
+
+// status 命中状态页路径返回true
+func (fss *server) status(ctx *RequestCtx) bool {
+	if fss.cfg.status == "" || string(ctx.Path()) != fss.cfg.status {
+		return false
+	}
+
+	if !fss.statusAllow(ctx) {
+		ctx.Error("forbidden", fasthttp.StatusForbidden)
+		return true
+	}
+
+	snap := fss.snapshot()
+	format := string(ctx.QueryArgs().Peek("format"))
+	if format == "" && strings.Contains(string(ctx.Request.Header.Peek(fasthttp.HeaderAccept)), "text/html") {
+		format = "html"
+	}
+
+	if format == "html" {
+		ctx.SetContentType("text/html; charset=utf-8")
+		ctx.SetBodyString(snap.HTML())
+		return true
+	}
+
+	chunk, err := json.Marshal(snap)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return true
+	}
+
+	ctx.SetContentType("application/json")
+	ctx.SetBody(chunk)
+	return true
+}
+
+func (snap *statusSnapshot) HTML() string {
+	var b strings.Builder
+	e := html.EscapeString
+
+	table := func(title string, head []string, rows [][]string) {
+		b.WriteString("<h3>" + e(title) + "</h3><table border=\"1\" cellpadding=\"4\"><tr>")
+		for _, h := range head {
+			b.WriteString("<th>" + e(h) + "</th>")
+		}
+		b.WriteString("</tr>")
+		for _, row := range rows {
+			b.WriteString("<tr>")
+			for _, col := range row {
+				b.WriteString("<td>" + e(col) + "</td>")
+			}
+			b.WriteString("</tr>")
+		}
+		b.WriteString("</table>")
+	}
+
+	b.WriteString("<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>" + e(snap.Name) + " status</title></head><body>")
+
+	table("server", []string{"name", "uptime", "connections", "inflight", "requests", "rejected"}, [][]string{{
+		snap.Name, snap.Uptime, strconv.Itoa(snap.Connections), strconv.FormatInt(snap.Inflight, 10),
+		strconv.FormatUint(snap.Requests, 10), strconv.FormatUint(snap.Rejected, 10),
+	}})
+
+	var rows [][]string
+	var codes []string
+	for code := range snap.Status {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		rows = append(rows, []string{code, strconv.FormatUint(snap.Status[code], 10)})
+	}
+	table("status", []string{"code", "count"}, rows)
+
+	rows = nil
+	for _, item := range snap.Vhosts {
+		rows = append(rows, []string{item.Name, strconv.FormatUint(item.Count, 10)})
+	}
+	table("vhosts", []string{"vhost", "count"}, rows)
+
+	rows = nil
+	for _, item := range snap.Routes {
+		rows = append(rows, []string{item.Vhost, item.Method, item.Path, strconv.FormatUint(item.Count, 10)})
+	}
+	table("routes", []string{"vhost", "method", "path", "count"}, rows)
+
+	rows = nil
+	for _, item := range snap.Handles {
+		rows = append(rows, []string{item.Name, strconv.FormatUint(item.Count, 10)})
+	}
+	table("handles", []string{"handle", "count"}, rows)
+
+	rows = nil
+	for _, name := range []string{"vhost", "router", "handle", "cert"} {
+		rows = append(rows, []string{name, strconv.Itoa(snap.Pools[name])})
+	}
+	table("pools", []string{"pool", "size"}, rows)
+
+	rows = nil
+	for _, item := range snap.Errors {
+		rows = append(rows, []string{item.Time.Format(time.RFC3339), item.Name, item.Error})
+	}
+	table("errors", []string{"time", "file", "error"}, rows)
+
+	b.WriteString("</body></html>")
+	return b.String()
+}
@@ -2,6 +2,7 @@ package fasthttp
 
 import (
 	"github.com/vela-ssoc/vela-kit/lua"
+	"sync/atomic"
 )
 
 func newLuaThread(ctx *RequestCtx) *lua.LState {
@@ -17,12 +18,14 @@ func newLuaThread(ctx *RequestCtx) *lua.LState {
 	if cv != nil {
 		if cfg, ok := cv.(*config); ok {
 			co = xEnv.Clone(cfg.co)
+			atomic.AddUint64(&luaThreadClone, 1)
 			co.SetValue(web_context_key, ctx)
 			goto done
 		}
 	}
 
 	co = xEnv.Coroutine()
+	atomic.AddUint64(&luaThreadCoroutine, 1)
 	co.SetValue(web_context_key, ctx)
 	goto done
 
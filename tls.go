@@ -0,0 +1,55 @@
+package fasthttp
+
+import (
+	"crypto/tls"
+	"fmt"
+	"golang.org/x/net/http2"
+)
+
+func (fss *server) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var c *certificate
+	var err error
+
+	if hello.ServerName == "" {
+		goto fallback
+	}
+
+	//按照SNI查找vhost证书
+	if r := fss.lookupVhost(normalizeHost(hello.ServerName)); r != nil {
+		c, err = r.certificate()
+		if err != nil {
+			xEnv.Errorf("%s web %s certificate load error %v", fss.Name(), hello.ServerName, err)
+			return nil, err
+		}
+
+		if c != nil {
+			return c.cert, nil
+		}
+	}
+
+fallback:
+	if fss.cfg.cert == "" {
+		return nil, fmt.Errorf("not found %s certificate", hello.ServerName)
+	}
+
+	c, err = requireCertificate(fss.cfg.cert, fss.cfg.key)
+	if err != nil {
+		xEnv.Errorf("%s web certificate load error %v", fss.Name(), err)
+		return nil, err
+	}
+
+	return c.cert, nil
+}
+
+func (fss *server) tlsConfig(h2 bool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: fss.GetCertificate,
+	}
+
+	if h2 {
+		cfg.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	}
+
+	return cfg
+}
@@ -0,0 +1,248 @@
+package fasthttp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"net/http"
+	"time"
+)
+
+const (
+	trace_uv_key      = "__trace_span__"
+	traceParentHeader = "traceparent"
+	traceStateHeader  = "tracestate"
+	maxTraceStateSize = 512
+	traceFlagSampled  = 0x01
+)
+
+const (
+	spanKindServer   = "server"
+	spanKindInternal = "internal"
+	spanKindClient   = "client"
+)
+
+// spanRecord 输出到trace的json记录
+type spanRecord struct {
+	TraceID      string                 `json:"trace_id"`
+	SpanID       string                 `json:"span_id"`
+	ParentID     string                 `json:"parent_id,omitempty"`
+	RemoteParent bool                   `json:"remote_parent"`
+	Name         string                 `json:"name"`
+	Kind         string                 `json:"kind"`
+	Start        string                 `json:"start"`
+	End          string                 `json:"end"`
+	Duration     int64                  `json:"duration_us"`
+	Status       string                 `json:"status"`
+	Error        string                 `json:"error,omitempty"`
+	TraceState   string                 `json:"tracestate,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// span W3C trace context 的一个片段 结束时以json输出到trace
+type span struct {
+	w       lua.Writer
+	traceID [16]byte
+	id      [8]byte
+	parent  [8]byte
+	remote  bool //父节点来自请求头
+	root    bool //没有父节点
+	flags   byte
+	state   string
+
+	name  string
+	kind  string
+	start time.Time
+	err   string
+	attrs map[string]interface{}
+}
+
+func randomID(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		//随机数读取失败时使用时间 保证不是全0
+		ts := time.Now().UnixNano()
+		for i := range b {
+			b[i] = byte(ts >> (uint(i%8) * 8))
+		}
+		b[0] |= 0x01
+	}
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTraceParent version-trace_id-parent_id-flags 非法时返回false
+func parseTraceParent(v []byte, sp *span) bool {
+	if len(v) < 55 || v[2] != '-' || v[35] != '-' || v[52] != '-' {
+		return false
+	}
+
+	var version, flags [1]byte
+	if _, err := hex.Decode(version[:], v[0:2]); err != nil || version[0] == 0xff {
+		return false
+	}
+
+	//版本00必须正好55个字符 更高版本允许后面追加字段
+	if (version[0] == 0 && len(v) != 55) || (len(v) > 55 && v[55] != '-') {
+		return false
+	}
+
+	if _, err := hex.Decode(sp.traceID[:], v[3:35]); err != nil {
+		return false
+	}
+	if _, err := hex.Decode(sp.parent[:], v[36:52]); err != nil {
+		return false
+	}
+	if _, err := hex.Decode(flags[:], v[53:55]); err != nil {
+		return false
+	}
+
+	if allZero(sp.traceID[:]) || allZero(sp.parent[:]) {
+		return false
+	}
+
+	sp.flags = flags[0]
+	return true
+}
+
+// startRequestSpan 开启请求的span 请求头中有合法的traceparent时继续原来的链路
+func (fss *server) startRequestSpan(ctx *RequestCtx) *span {
+	w := fss.cfg.trace
+	if w == nil {
+		return nil
+	}
+
+	sp := &span{w: w, name: "request", kind: spanKindServer, start: time.Now()}
+	if parseTraceParent(ctx.Request.Header.Peek(traceParentHeader), sp) {
+		sp.remote = true
+		if state := ctx.Request.Header.Peek(traceStateHeader); len(state) <= maxTraceStateSize {
+			sp.state = string(state)
+		}
+	} else {
+		sp.root = true
+		sp.flags = traceFlagSampled
+		randomID(sp.traceID[:])
+	}
+	randomID(sp.id[:])
+
+	ctx.SetUserValue(trace_uv_key, sp)
+	return sp
+}
+
+// endRequestSpan 记录请求的路由和状态码 5xx记为错误
+func (fss *server) endRequestSpan(sp *span, r *vRouter, ctx *RequestCtx) {
+	if sp == nil {
+		return
+	}
+
+	code := ctx.Response.StatusCode()
+	sp.Set("server", fss.Name())
+	sp.Set("vhost", vhostLabel(r))
+	sp.Set("request_id", requestIDOf(ctx))
+	sp.Set("http.method", string(ctx.Method()))
+	sp.Set("http.host", string(ctx.Host()))
+	sp.Set("http.status_code", code)
+	if rt := routeOf(ctx); rt != nil {
+		sp.Set("http.route", rt.path)
+	}
+
+	if code >= 500 {
+		sp.err = http.StatusText(code)
+	}
+	sp.End()
+}
+
+func spanOf(ctx *RequestCtx) *span {
+	sp, _ := ctx.UserValue(trace_uv_key).(*span)
+	return sp
+}
+
+// startSpan 在当前请求的span下开启子span 没有开启trace时返回nil
+func startSpan(ctx *RequestCtx, name string, kind string) *span {
+	parent := spanOf(ctx)
+	if parent == nil {
+		return nil
+	}
+
+	sp := &span{
+		w:       parent.w,
+		traceID: parent.traceID,
+		parent:  parent.id,
+		flags:   parent.flags,
+		state:   parent.state,
+		name:    name,
+		kind:    kind,
+		start:   time.Now(),
+	}
+	randomID(sp.id[:])
+	return sp
+}
+
+func (sp *span) Set(key string, val interface{}) {
+	if sp == nil {
+		return
+	}
+
+	if sp.attrs == nil {
+		sp.attrs = make(map[string]interface{})
+	}
+	sp.attrs[key] = val
+}
+
+func (sp *span) Error(err error) {
+	if sp == nil || err == nil {
+		return
+	}
+	sp.err = err.Error()
+}
+
+// TraceParent 向下游传递的traceparent
+func (sp *span) TraceParent() string {
+	return "00-" + hex.EncodeToString(sp.traceID[:]) + "-" +
+		hex.EncodeToString(sp.id[:]) + "-" + hex.EncodeToString([]byte{sp.flags})
+}
+
+// End 结束span 只有采样的链路才输出
+func (sp *span) End() {
+	if sp == nil || sp.flags&traceFlagSampled == 0 {
+		return
+	}
+
+	end := time.Now()
+	rec := spanRecord{
+		TraceID:      hex.EncodeToString(sp.traceID[:]),
+		SpanID:       hex.EncodeToString(sp.id[:]),
+		RemoteParent: sp.remote,
+		Name:         sp.name,
+		Kind:         sp.kind,
+		Start:        sp.start.Format(time.RFC3339Nano),
+		End:          end.Format(time.RFC3339Nano),
+		Duration:     end.Sub(sp.start).Microseconds(),
+		Status:       "ok",
+		Error:        sp.err,
+		TraceState:   sp.state,
+		Attributes:   sp.attrs,
+	}
+
+	if !sp.root {
+		rec.ParentID = hex.EncodeToString(sp.parent[:])
+	}
+
+	if sp.err != "" {
+		rec.Status = "error"
+	}
+
+	chunk, err := json.Marshal(rec)
+	if err != nil {
+		xEnv.Errorf("trace span %s marshal error %v", sp.name, err)
+		return
+	}
+	sp.w.Write(chunk)
+}
@@ -0,0 +1,391 @@
+package fasthttp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/valyala/fasthttp"
+	"github.com/vela-ssoc/vela-kit/auxlib"
+	"github.com/vela-ssoc/vela-kit/lua"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultProxyTimeout     = 30 // 秒
+	defaultProxyDialTimeout = 5
+)
+
+// hopHeaders 逐跳头 不转发给上游也不返回给客户端
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// upstream web.proxy{} 反向代理
+type upstream struct {
+	raw    string
+	scheme string
+	host   string //上游的host头
+	base   string //上游地址中的路径前缀
+
+	strip        string
+	preserveHost bool
+
+	header     *header  //转发前设置的请求头
+	remove     []string //转发前删除的请求头
+	respHeader *header  //返回前设置的响应头
+	hide       []string //返回前删除的响应头
+
+	readTimeout  int
+	writeTimeout int
+	dialTimeout  int
+	maxConns     int
+	insecure     bool
+
+	hc *fasthttp.HostClient
+}
+
+func newUpstream(raw string) (*upstream, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid upstream scheme %s", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, errors.New("invalid upstream host")
+	}
+
+	return &upstream{
+		raw:          raw,
+		scheme:       u.Scheme,
+		host:         u.Host,
+		base:         strings.TrimSuffix(u.Path, "/"),
+		readTimeout:  defaultProxyTimeout,
+		writeTimeout: defaultProxyTimeout,
+		dialTimeout:  defaultProxyDialTimeout,
+	}, nil
+}
+
+// addr HostClient的地址 没有端口时按照协议补全
+func (up *upstream) addr() string {
+	if _, _, err := net.SplitHostPort(up.host); err == nil {
+		return up.host
+	}
+
+	if up.scheme == "https" {
+		return up.host + ":443"
+	}
+	return up.host + ":80"
+}
+
+func (up *upstream) compile() {
+	dial := time.Duration(up.dialTimeout) * time.Second
+	up.hc = &fasthttp.HostClient{
+		Addr:                     up.addr(),
+		IsTLS:                    up.scheme == "https",
+		MaxConns:                 up.maxConns,
+		ReadTimeout:              time.Duration(up.readTimeout) * time.Second,
+		WriteTimeout:             time.Duration(up.writeTimeout) * time.Second,
+		NoDefaultUserAgentHeader: true,
+		StreamResponseBody:       true,
+		Dial: func(addr string) (net.Conn, error) {
+			return fasthttp.DialTimeout(addr, dial)
+		},
+	}
+
+	if up.insecure {
+		up.hc.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+}
+
+// close 释放空闲的上游连接 正在转发的请求不受影响
+func (up *upstream) close() {
+	if up.hc != nil {
+		up.hc.CloseIdleConnections()
+	}
+}
+
+// path 去掉strip_prefix后加上上游地址中的路径
+func (up *upstream) path(ctx *RequestCtx) string {
+	path := string(ctx.URI().Path())
+	if up.strip != "" && strings.HasPrefix(path, up.strip) {
+		if rest := path[len(up.strip):]; rest == "" || rest[0] == '/' {
+			path = "/" + strings.TrimPrefix(rest, "/")
+		}
+	}
+	return up.base + path
+}
+
+// forwarded X-Forwarded-For追加客户端地址
+func forwarded(ctx *RequestCtx, req *fasthttp.Request) {
+	ip := ctx.RemoteIP().String()
+	if prior := req.Header.Peek(fasthttp.HeaderXForwardedFor); len(prior) > 0 {
+		ip = string(prior) + ", " + ip
+	}
+	req.Header.Set(fasthttp.HeaderXForwardedFor, ip)
+	req.Header.Set(fasthttp.HeaderXForwardedHost, string(ctx.Host()))
+
+	proto := "http"
+	if ctx.IsTLS() {
+		proto = "https"
+	}
+	req.Header.Set(fasthttp.HeaderXForwardedProto, proto)
+}
+
+// connectionHeaders Connection头中列出的字段也是逐跳头
+func connectionHeaders(v []byte) []string {
+	var names []string
+	for _, item := range bytes.Split(v, []byte(",")) {
+		if item = bytes.TrimSpace(item); len(item) > 0 {
+			names = append(names, string(item))
+		}
+	}
+	return names
+}
+
+func hasHeaderName(names []string, key []byte) bool {
+	for _, name := range names {
+		if strings.EqualFold(name, string(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (up *upstream) request(ctx *RequestCtx, req *fasthttp.Request, sp *span) {
+	ctx.Request.CopyTo(req)
+	for _, key := range connectionHeaders(req.Header.Peek(fasthttp.HeaderConnection)) {
+		req.Header.Del(key)
+	}
+
+	for _, key := range hopHeaders {
+		req.Header.Del(key)
+	}
+
+	uri := req.URI()
+	uri.SetScheme(up.scheme)
+	uri.SetPath(up.path(ctx))
+	uri.SetQueryStringBytes(ctx.URI().QueryString())
+	if up.preserveHost {
+		uri.SetHostBytes(ctx.Host())
+	} else {
+		uri.SetHost(up.host)
+		req.Header.SetHost(up.host)
+	}
+
+	forwarded(ctx, req)
+
+	//转发请求id和链路
+	if id := requestIDOf(ctx); id != "" {
+		req.Header.Set(requestIDHeaderOf(ctx), id)
+	}
+
+	if sp != nil {
+		req.Header.Set(traceParentHeader, sp.TraceParent())
+		if sp.state != "" {
+			req.Header.Set(traceStateHeader, sp.state)
+		}
+	}
+
+	for _, key := range up.remove {
+		req.Header.Del(key)
+	}
+
+	if up.header != nil {
+		up.header.ForEach(func(key string, val string) {
+			req.Header.Set(key, val)
+		})
+	}
+}
+
+// proxyBody 上游的响应体 发送完成后释放上游响应 连接回到HostClient
+type proxyBody struct {
+	io.Reader
+	resp *fasthttp.Response
+}
+
+func (pb *proxyBody) Close() error {
+	fasthttp.ReleaseResponse(pb.resp)
+	return nil
+}
+
+// response 复制上游的状态码和响应头 不重置ctx.Response 之前设置的头(例如Alt-Svc)保留
+func (up *upstream) response(ctx *RequestCtx, resp *fasthttp.Response) {
+	skip := connectionHeaders(resp.Header.Peek(fasthttp.HeaderConnection))
+	skip = append(skip, hopHeaders...)
+	skip = append(skip, up.hide...)
+	skip = append(skip, fasthttp.HeaderContentLength)
+
+	ctx.SetStatusCode(resp.StatusCode())
+
+	//上游返回的同名头覆盖之前的设置
+	resp.Header.VisitAll(func(key, val []byte) {
+		if !hasHeaderName(skip, key) {
+			ctx.Response.Header.DelBytes(key)
+		}
+	})
+
+	resp.Header.VisitAll(func(key, val []byte) {
+		if !hasHeaderName(skip, key) {
+			ctx.Response.Header.AddBytesKV(key, val)
+		}
+	})
+
+	if up.respHeader != nil {
+		up.respHeader.ForEach(func(key string, val string) {
+			ctx.Response.Header.Set(key, val)
+		})
+	}
+
+	stream := resp.BodyStream()
+	if stream == nil {
+		body := resp.Body()
+		ctx.Response.SetBody(body)
+
+		//HEAD 204 304等没有响应体 保留上游的Content-Length
+		if n := resp.Header.ContentLength(); n >= 0 && len(body) == 0 {
+			ctx.Response.Header.SetContentLength(n)
+		}
+		fasthttp.ReleaseResponse(resp)
+		return
+	}
+
+	size := resp.Header.ContentLength()
+	if size < 0 {
+		size = -1
+	}
+	ctx.Response.SetBodyStream(&proxyBody{Reader: stream, resp: resp}, size)
+}
+
+// do 转发完整的请求 响应体以流的方式返回 上游失败返回502 超时返回504
+func (up *upstream) do(ctx *RequestCtx) error {
+	sp := startSpan(ctx, "proxy", spanKindClient)
+	sp.Set("http.url", up.raw)
+
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	//单独的响应对象 HostClient.Do会重置响应
+	resp := fasthttp.AcquireResponse()
+	up.request(ctx, req, sp)
+	err := up.hc.Do(req, resp)
+	if err != nil {
+		fasthttp.ReleaseResponse(resp)
+		sp.Error(err)
+		sp.End()
+		requestErrorf(ctx, "proxy %s%s fail %v", up.raw, ctx.Path(), err)
+
+		code := fasthttp.StatusBadGateway
+		if errors.Is(err, fasthttp.ErrTimeout) || errors.Is(err, fasthttp.ErrDialTimeout) {
+			code = fasthttp.StatusGatewayTimeout
+		}
+		ctx.Error(fasthttp.StatusMessage(code), code)
+		return nil
+	}
+
+	sp.Set("http.status_code", resp.StatusCode())
+	sp.End()
+	up.response(ctx, resp)
+	return nil
+}
+
+func (up *upstream) NewIndex(L *lua.LState, key string, val lua.LValue) bool {
+	switch key {
+	case "strip_prefix":
+		up.strip = strings.TrimSuffix(val.String(), "/")
+	case "preserve_host":
+		up.preserveHost = lua.IsTrue(val)
+	case "header":
+		up.header = toHeader(L, val)
+	case "remove_header":
+		up.remove = checkHeaderNames(L, val)
+	case "resp_header":
+		up.respHeader = toHeader(L, val)
+	case "hide_header":
+		up.hide = checkHeaderNames(L, val)
+	case "timeout":
+		up.readTimeout = lua.IsInt(val)
+		up.writeTimeout = up.readTimeout
+	case "read_timeout":
+		up.readTimeout = lua.IsInt(val)
+	case "write_timeout":
+		up.writeTimeout = lua.IsInt(val)
+	case "connect_timeout":
+		up.dialTimeout = lua.IsInt(val)
+	case "max_conns":
+		up.maxConns = lua.IsInt(val)
+	case "insecure":
+		up.insecure = lua.IsTrue(val)
+	default:
+		return false
+	}
+	return true
+}
+
+func checkHeaderNames(L *lua.LState, val lua.LValue) []string {
+	switch val.Type() {
+	case lua.LTTable:
+		return auxlib.LTab2SS(val.(*lua.LTable))
+	case lua.LTString:
+		var names []string
+		for _, item := range strings.Split(val.String(), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				names = append(names, item)
+			}
+		}
+		return names
+	default:
+		L.RaiseError("header names must be string or table got %s", val.Type().String())
+		return nil
+	}
+}
+
+// newLuaProxyL web.proxy{upstream = "http://127.0.0.1:8080"} 可以放在任意handle的位置
+func newLuaProxyL(L *lua.LState) int {
+	tab := L.CheckTable(1)
+
+	raw := tab.RawGetString("upstream")
+	if raw.Type() != lua.LTString {
+		L.RaiseError("web.proxy upstream must be string got %s", raw.Type().String())
+		return 0
+	}
+
+	up, err := newUpstream(raw.String())
+	if err != nil {
+		L.RaiseError("web.proxy %s %v", raw.String(), err)
+		return 0
+	}
+
+	hd := newHandle("")
+	tab.Range(func(key string, val lua.LValue) {
+		if key == "upstream" || up.NewIndex(L, key, val) {
+			return
+		}
+
+		//method filter等handle的字段
+		hd.NewIndex(L, key, val)
+	})
+
+	up.compile()
+	hd.up = up
+	hd.body = up.do
+	hd.eof = true
+	L.Push(hd)
+	return 1
+}
@@ -0,0 +1,191 @@
+package fasthttp
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+// memUpstream 上游服务跑在内存监听上 HostClient通过ln.Dial连接
+func memUpstream(t *testing.T, raw string, handler fasthttp.RequestHandler) (*upstream, *fasthttputil.InmemoryListener) {
+	ln := fasthttputil.NewInmemoryListener()
+	go fasthttp.Serve(ln, handler)
+	t.Cleanup(func() { ln.Close() })
+
+	up, err := newUpstream(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up.compile()
+	up.hc.Dial = func(string) (net.Conn, error) { return ln.Dial() }
+	return up, ln
+}
+
+func proxyRequest(up *upstream, method, uri, body string, header map[string]string) *RequestCtx {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+
+	req.Header.SetMethod(method)
+	req.SetRequestURI(uri)
+	req.SetBodyString(body)
+	for key, val := range header {
+		req.Header.Set(key, val)
+	}
+
+	ctx := &RequestCtx{}
+	ctx.Init(req, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5000}, nil)
+	ctx.Response.Header.Set("Alt-Svc", `h3=":443"; ma=86400`)
+	_ = up.do(ctx)
+	return ctx
+}
+
+func TestUpstreamForward(t *testing.T) {
+	useTestEnv(t)
+
+	up, _ := memUpstream(t, "http://backend/base/", func(ctx *fasthttp.RequestCtx) {
+		h := &ctx.Request.Header
+		ctx.Response.Header.Set("Connection", "X-Hop")
+		ctx.Response.Header.Set("X-Hop", "1")
+		ctx.Response.Header.Set("X-Back", "yes")
+		ctx.SetStatusCode(fasthttp.StatusCreated)
+		ctx.SetBodyString(strings.Join([]string{
+			string(ctx.Method()),
+			string(ctx.RequestURI()),
+			string(ctx.Host()),
+			string(h.Peek("X-Forwarded-For")),
+			string(h.Peek("X-Forwarded-Host")),
+			string(h.Peek("X-Forwarded-Proto")),
+			string(h.Peek("X-Drop")),
+			string(ctx.PostBody()),
+		}, "|"))
+	})
+	up.strip = "/api"
+
+	ctx := proxyRequest(up, "POST", "http://front.com/api/x/y?a=1&b=2", "hello", map[string]string{
+		"X-Forwarded-For": "9.9.9.9",
+		"Connection":      "X-Drop",
+		"X-Drop":          "1",
+	})
+
+	if code := ctx.Response.StatusCode(); code != fasthttp.StatusCreated {
+		t.Fatalf("status got %d want 201", code)
+	}
+
+	want := "POST|/base/x/y?a=1&b=2|backend|9.9.9.9, 10.0.0.1|front.com|http||hello"
+	if body := string(ctx.Response.Body()); body != want {
+		t.Fatalf("body got %q want %q", body, want)
+	}
+
+	h := &ctx.Response.Header
+	if v := string(h.Peek("X-Back")); v != "yes" {
+		t.Errorf("X-Back got %q", v)
+	}
+
+	if v := string(h.Peek("X-Hop")); v != "" {
+		t.Errorf("X-Hop listed in Connection got %q", v)
+	}
+
+	if v := string(h.Peek("Alt-Svc")); v != `h3=":443"; ma=86400` {
+		t.Errorf("Alt-Svc got %q", v)
+	}
+}
+
+func TestUpstreamStripPrefix(t *testing.T) {
+	useTestEnv(t)
+
+	up, _ := memUpstream(t, "http://backend", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBody(ctx.RequestURI())
+	})
+	up.strip = "/api"
+
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"/api", "/"},
+		{"/api/", "/"},
+		{"/api/v1?q=1", "/v1?q=1"},
+		{"/apix", "/apix"},
+		{"/other/api", "/other/api"},
+	}
+
+	for _, tt := range tests {
+		ctx := proxyRequest(up, "GET", "http://front.com"+tt.uri, "", nil)
+		if got := string(ctx.Response.Body()); got != tt.want {
+			t.Errorf("%s got %s want %s", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamError(t *testing.T) {
+	useTestEnv(t)
+
+	//上游已经关闭
+	closed, ln := memUpstream(t, "http://backend", func(ctx *fasthttp.RequestCtx) {})
+	ln.Close()
+
+	ctx := proxyRequest(closed, "GET", "http://front.com/", "", nil)
+	if code := ctx.Response.StatusCode(); code != fasthttp.StatusBadGateway {
+		t.Errorf("closed upstream got %d want 502", code)
+	}
+
+	//上游超过read_timeout
+	slow, _ := memUpstream(t, "http://backend", func(ctx *fasthttp.RequestCtx) {
+		time.Sleep(1500 * time.Millisecond)
+	})
+	slow.hc.ReadTimeout = time.Second
+
+	//POST不会重试 GET超时后HostClient会重试
+	ctx = proxyRequest(slow, "POST", "http://front.com/", "", nil)
+	if code := ctx.Response.StatusCode(); code != fasthttp.StatusGatewayTimeout {
+		t.Errorf("slow upstream got %d want 504", code)
+	}
+}
+
+func TestUpstreamCloseIdle(t *testing.T) {
+	useTestEnv(t)
+
+	up, _ := memUpstream(t, "http://backend", func(ctx *fasthttp.RequestCtx) {})
+	//读完响应体后连接回到HostClient
+	ctx := proxyRequest(up, "GET", "http://front.com/", "", nil)
+	ctx.Response.Body()
+	if n := up.hc.ConnsCount(); n != 1 {
+		t.Fatalf("idle conns got %d want 1", n)
+	}
+
+	hc := newHandleChains(1)
+	hc.Store(&handle{up: up}, VHANDLER, 0)
+	r := &vRouter{routes: []*route{{chains: hc}}}
+
+	//路由关闭后释放web.proxy的空闲连接
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := up.hc.ConnsCount(); n != 0 {
+		t.Fatalf("idle conns after close got %d want 0", n)
+	}
+}
+
+func TestUpstreamHeadLength(t *testing.T) {
+	useTestEnv(t)
+
+	up, _ := memUpstream(t, "http://backend", func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString("hello")
+	})
+
+	ctx := proxyRequest(up, "HEAD", "http://front.com/", "", nil)
+	if n := ctx.Response.Header.ContentLength(); n != 5 {
+		t.Fatalf("content length got %d want 5", n)
+	}
+
+	//和fasthttp处理HEAD请求一样跳过响应体输出
+	ctx.Response.SkipBody = true
+	if raw := ctx.Response.String(); !strings.Contains(raw, "Content-Length: 5\r\n") {
+		t.Fatalf("response got %q", raw)
+	}
+}
@@ -19,32 +19,27 @@ func checkHandleChains(L *lua.LState, seek int) *HandleChains {
 	}
 
 	hc := newHandleChains(n - seek)
-	var val lua.LValue
 	for i := 2; i <= n; i++ {
+		hc.StoreL(L.Get(i), i-2)
+	}
 
-		val = L.Get(i)
-		switch val.Type() {
-
-		//判断是否为加载
-		case lua.LTString:
-			hc.Store(val.String(), VHSTRING, i-2)
-
-		case lua.LTObject:
-			hd, ok := val.(*handle)
-			if ok {
-				hc.Store(hd, VHANDLER, i-2)
-			} else {
-				hc.Store(val.String(), VHSTRING, i-2)
-			}
-
-		case lua.LTFunction:
-			hc.Store(val.(*lua.LFunction), VHFUNC, i-2)
+	return hc
+}
 
-		default:
-			hc.Store(val.String(), VHSTRING, i-2)
-		}
+// newHandleChainsL 配置中的handle 可以是单个值或者列表
+func newHandleChainsL(val lua.LValue) *HandleChains {
+	tab, ok := val.(*lua.LTable)
+	if !ok {
+		hc := newHandleChains(1)
+		hc.StoreL(val, 0)
+		return hc
 	}
 
+	n := tab.Len()
+	hc := newHandleChains(n)
+	for i := 1; i <= n; i++ {
+		hc.StoreL(tab.RawGetInt(i), i-1)
+	}
 	return hc
 }
 
@@ -190,6 +185,7 @@ func requireHandle(path, name string) (*handle, error) {
 	}
 
 	hd, err := compileHandle(filename)
+	recordCompile("handle", filename, err)
 	if err != nil {
 		return nil, err
 	}
@@ -240,6 +236,7 @@ func requireRouter(path, handler, host string) (*vRouter, error) {
 	}
 
 	r, err := compileRouter(filename, handler)
+	recordCompile("router", filename, err)
 	if err != nil {
 		return nil, err
 	}
@@ -265,6 +262,7 @@ func checkLuaEof(ctx *RequestCtx) bool {
 func panicHandler(ctx *RequestCtx, val interface{}) {
 	ctx.Response.SetStatusCode(fasthttp.StatusInternalServerError)
 	e := fmt.Sprintf("%v %s", val, debug.Stack())
+	requestErrorf(ctx, "panic %v", val)
 	ctx.Response.SetBodyString(e)
 }
 
@@ -293,3 +291,13 @@ func setUserValueByMap(tab map[string]string, ctx *RequestCtx) {
 		ctx.SetUserValue(k, v)
 	}
 }
+
+// serverHeader 当前web配置的server头 没有配置使用默认值
+func serverHeader(ctx *RequestCtx) string {
+	cfg, ok := ctx.UserValue(web_conf_key).(*config)
+	if !ok {
+		return velaServerHeader
+	}
+
+	return cfg.serverHeader()
+}
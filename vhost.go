@@ -26,12 +26,18 @@ func (v *vhost) Name() string {
 }
 
 func (v *vhost) Start() error {
-	v.fss.vhost.insert(v.host, v.r)
-	return nil
+	if _, err := v.r.certificate(); err != nil {
+		return err
+	}
+
+	return v.fss.addVhost(v.host, v.r)
 }
 
 func (v *vhost) Close() error {
-	v.fss.vhost.clear(v.name)
+	v.fss.vhost.remove(hostKey(v.host))
+	if v.r.cert != "" && !certInUse(v.r.cert) {
+		certPool.remove(v.r.cert)
+	}
 	v.V(lua.VTClose, time.Now())
 	return nil
 }
@@ -67,13 +73,14 @@ func newLuaHost(L *lua.LState) int {
 
 	old := proc.Data.(*vhost)
 
-	//如果切换web服务中心
-	if old.fss.Name() != app.fss.Name() {
-		old.fss.vhost.clear(app.Name())
-		xEnv.Errorf("%s web %s vhost clear from %s", old.fss.Name(), old.Name())
+	//如果切换web服务中心或者主机名
+	if old.fss.Name() != app.fss.Name() || old.host != app.host {
+		old.fss.vhost.remove(hostKey(old.host))
+		xEnv.Errorf("%s web %s vhost clear from %s", old.fss.Name(), old.Name(), old.host)
 	}
 
 	old.fss = app.fss
+	old.host = app.host
 	old.r = app.r
 	L.Push(proc)
 	return 1